@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Store is the subset of the workflow cache used by the workflow.
+type Store interface {
+	Store(name string, data []byte) error
+	LoadJSON(name string, v interface{}) error
+	StoreJSON(name string, v interface{}) error
+}
+
+// Soft wraps a Store so that failing writes never surface to the user. The
+// features built on the cache degrade to not remembering anything, while
+// search keeps working.
+type Soft struct {
+	Backend Store
+	Debug   bool
+}
+
+func NewSoft(backend Store, debug bool) Soft {
+	return Soft{Backend: backend, Debug: debug}
+}
+
+func (s Soft) LoadJSON(name string, v interface{}) error {
+	return s.Backend.LoadJSON(name, v)
+}
+
+// Store stores data and swallows the error, logging it in debug mode.
+func (s Soft) Store(name string, data []byte) error {
+	s.logFailure(name, s.Backend.Store(name, data))
+	return nil
+}
+
+// StoreJSON stores v and swallows the error, logging it in debug mode.
+func (s Soft) StoreJSON(name string, v interface{}) error {
+	s.logFailure(name, s.Backend.StoreJSON(name, v))
+	return nil
+}
+
+func (s Soft) logFailure(name string, err error) {
+	if err != nil && s.Debug {
+		log.Printf("Cache write %s failed: %v", name, err)
+	}
+}
+
+// Delete removes the cache entry. The workflow cache deletes an entry when
+// storing nil data.
+func (s Soft) Delete(name string) error {
+	return s.Backend.Store(name, nil)
+}
+
+// EnsureWritableDir points the environment variable at a temporary directory
+// when the directory it names cannot be created or written to. The workflow
+// library refuses to start with an unusable cache or data directory.
+func EnsureWritableDir(envName string) {
+	dir := os.Getenv(envName)
+	if dir == "" || writable(dir) {
+		return
+	}
+
+	fallback := filepath.Join(os.TempDir(), filepath.Base(dir))
+	log.Printf("%s %s is not writable, using %s", envName, dir, fallback)
+	_ = os.Setenv(envName, fallback)
+}
+
+func writable(dir string) bool {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-")
+	if err != nil {
+		return false
+	}
+
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// unwritableDir returns a directory path that cannot be created, as its
+// parent is a regular file. Permissions alone do not stop root.
+func unwritableDir(t *testing.T) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(file, "craftdocs-test-"+strconv.Itoa(os.Getpid()))
+}
+
+func TestSoftUnwritableCacheDir(t *testing.T) {
+	backend := &aw.Cache{Dir: unwritableDir(t)}
+	if err := backend.Store("entry", []byte("data")); err == nil {
+		t.Fatal("the backend stored into an unwritable dir, the test proves nothing")
+	}
+
+	soft := NewSoft(backend, true)
+	if err := soft.Store("entry", []byte("data")); err != nil {
+		t.Errorf("Store() error = %v, want it swallowed", err)
+	}
+	if err := soft.StoreJSON("entry", map[string]string{"a": "b"}); err != nil {
+		t.Errorf("StoreJSON() error = %v, want it swallowed", err)
+	}
+
+	var v map[string]string
+	if err := soft.LoadJSON("entry", &v); err == nil {
+		t.Error("LoadJSON() found an entry that was never stored")
+	}
+}
+
+func TestEnsureWritableDir(t *testing.T) {
+	const envName = "CRAFTDOCS_TEST_CACHE_DIR"
+	t.Cleanup(func() { _ = os.Unsetenv(envName) })
+
+	writableDir := t.TempDir()
+	_ = os.Setenv(envName, writableDir)
+	EnsureWritableDir(envName)
+	if got := os.Getenv(envName); got != writableDir {
+		t.Errorf("writable dir replaced by %q", got)
+	}
+
+	dir := unwritableDir(t)
+	_ = os.Setenv(envName, dir)
+	EnsureWritableDir(envName)
+	got := os.Getenv(envName)
+	t.Cleanup(func() { _ = os.RemoveAll(got) })
+	if got == dir {
+		t.Fatal("unwritable dir kept")
+	}
+	if !writable(got) {
+		t.Errorf("fallback %q is not writable", got)
+	}
+}
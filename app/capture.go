@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+// captureMode is the value of the mode variable for a keyword that appends
+// the query to a document instead of searching.
+const captureMode = "capture"
+
+// captureURL returns the URL that appends the text as a new block at the end
+// of the document.
+func captureURL(spaceID, documentID, text string) string {
+	query := url.Values{}
+	query.Set("spaceId", spaceID)
+	query.Set("parentBlockId", documentID)
+	query.Set("content", text)
+
+	// Craft decodes %20 but not + as a space
+	return "craftdocs://createblock?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// addCapture offers to append the query to the CAPTURE_DOCUMENT_ID document,
+// or else to today's daily note.
+func addCapture(ctx context.Context, wf *aw.Workflow, cfg *config.Config, blockService *service.BlockService, opts repository.SearchOptions, args []string) error {
+	text := strings.TrimSpace(strings.Join(args, " "))
+	if text == "" {
+		return nil
+	}
+
+	spaceID, documentID, target := opts.CurrentSpaceID, cfg.CaptureDocumentID, "capture document"
+	if spaceID == "" {
+		spaceID = cfg.PrimarySpaceID()
+	}
+
+	if documentID == "" {
+		notes, err := blockService.DailyNotes(ctx, "today", opts)
+		if err != nil {
+			return fmt.Errorf("daily notes: %w", err)
+		}
+		if len(notes) == 0 {
+			wf.NewWarningItem("No daily note for today", "Open today's daily note in Craft first")
+			return nil
+		}
+		spaceID, documentID, target = notes[0].SpaceID, notes[0].DocumentID, "today's daily note"
+	}
+
+	item := wf.
+		NewItem(fmt.Sprintf("Capture %q", text)).
+		Subtitle("Append to " + target).
+		Arg(captureURL(spaceID, documentID, text)).
+		Valid(true)
+	disableModifiers(item, largeTypeMod, openAndCopyMod, listBlocksMod)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+func TestCaptureURL(t *testing.T) {
+	got := captureURL("s1", "doc1", "buy milk & eggs #home 1+1")
+
+	const want = "craftdocs://createblock?content=buy%20milk%20%26%20eggs%20%23home%201%2B1&parentBlockId=doc1&spaceId=s1"
+	if got != want {
+		t.Errorf("captureURL() = %q, want %q", got, want)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := u.Query().Get("content"); content != "buy milk & eggs #home 1+1" {
+		t.Errorf("content decodes to %q, want the typed text", content)
+	}
+}
+
+func TestAddCaptureModifiers(t *testing.T) {
+	wf := newTestWorkflow(t)
+	cfg := newTestConfig(t, map[string]string{"CAPTURE_DOCUMENT_ID": "inbox"}, "s1")
+
+	if err := addCapture(context.Background(), wf, cfg, nil, repository.SearchOptions{CurrentSpaceID: "s1"}, []string{"buy", "milk"}); err != nil {
+		t.Fatalf("addCapture() error = %v", err)
+	}
+
+	items := feedbackItems(t, wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	for _, keys := range [][]aw.ModKey{largeTypeMod, openAndCopyMod, listBlocksMod} {
+		if mod, ok := items[0].modifier(keys...); !ok || mod.Valid {
+			t.Errorf("modifier %v = %+v, want it set and invalid", keys, mod)
+		}
+	}
+}
+
+func TestAddCaptureDocument(t *testing.T) {
+	wf := newTestWorkflow(t)
+	cfg := newTestConfig(t, map[string]string{"CAPTURE_DOCUMENT_ID": "inbox"}, "s1")
+
+	if err := addCapture(context.Background(), wf, cfg, nil, repository.SearchOptions{}, []string{"buy", "milk"}); err != nil {
+		t.Fatalf("addCapture() error = %v", err)
+	}
+
+	item := feedbackItems(t, wf)[0]
+	if want := captureURL("s1", "inbox", "buy milk"); item.Arg != want {
+		t.Errorf("arg = %q, want %q", item.Arg, want)
+	}
+	if item.Subtitle != "Append to capture document" {
+		t.Errorf("subtitle = %q, want the capture document", item.Subtitle)
+	}
+}
+
+func TestAddCaptureDailyNote(t *testing.T) {
+	today := time.Now().Format("2006.01.02")
+	dir := t.TempDir()
+	writeTestIndex(t, dir, "s1",
+		repository.Block{ID: "old", Content: "2020.01.01", EntityType: "document", DocumentID: "old"},
+		repository.Block{ID: "today", Content: today, EntityType: "document", DocumentID: "today"},
+	)
+	db, err := sql.Open(sqliteDriver, filepath.Join(dir, "SearchIndex_s1.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	blockService := service.NewBlockService(repository.NewBlockRepo(repository.Space{ID: "s1", DB: db}))
+
+	wf := newTestWorkflow(t)
+	cfg := newTestConfig(t, nil, "s1")
+	if err := addCapture(context.Background(), wf, cfg, blockService, repository.SearchOptions{CurrentSpaceID: "s1"}, []string{"buy milk"}); err != nil {
+		t.Fatalf("addCapture() error = %v", err)
+	}
+
+	item := feedbackItems(t, wf)[0]
+	if want := captureURL("s1", "today", "buy milk"); item.Arg != want {
+		t.Errorf("arg = %q, want %q", item.Arg, want)
+	}
+	if !strings.Contains(item.Subtitle, "daily note") {
+		t.Errorf("subtitle = %q, want today's daily note", item.Subtitle)
+	}
+}
+
+func TestAddCaptureEmptyText(t *testing.T) {
+	wf := newTestWorkflow(t)
+
+	if err := addCapture(context.Background(), wf, newTestConfig(t, nil, "s1"), nil, repository.SearchOptions{}, []string{"  "}); err != nil {
+		t.Fatalf("addCapture() error = %v", err)
+	}
+	if !wf.IsEmpty() {
+		t.Errorf("addCapture() added %+v for an empty text", feedbackItems(t, wf))
+	}
+}
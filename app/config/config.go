@@ -3,12 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
 )
 
 var regexIndexName = regexp.MustCompile(`^SearchIndex_([a-zA-Z0-9-]+(?:\|\|[a-zA-Z0-9-]+)*)\.sqlite$`)
@@ -20,6 +25,8 @@ type SearchIndex struct {
 	SpaceID string
 	name    string
 	dir     string
+	primary bool      // the index is named after a single space
+	modTime time.Time // last modification of the index file
 }
 
 func (si SearchIndex) Path() string {
@@ -28,24 +35,406 @@ func (si SearchIndex) Path() string {
 
 type Config struct {
 	IndexPathDir string `env:"INDEX_PATH_DIR" envDefault:"~/Library/Containers/com.lukilabs.lukiapp/Data/Library/Application Support/com.lukilabs.lukiapp/Search"`
-	indexes      []SearchIndex
+	// WarmCache stores the parent document titles of the top results in the
+	// workflow cache after each query, for the next query to reuse.
+	WarmCache bool `env:"WARM_CACHE" envDefault:"false"`
+	// DefaultCreateSpace is the space new documents are created in when
+	// searching all spaces leaves the target ambiguous.
+	DefaultCreateSpace string `env:"DEFAULT_CREATE_SPACE"`
+	// ContextWindow is the number of sibling blocks shown around a matched
+	// block in Large Type. Zero disables fetching the context.
+	ContextWindow int `env:"CONTEXT_WINDOW" envDefault:"0"`
+	// Snippet cuts long block titles down to the match: "window" shows the
+	// characters around it, "sentence" the sentence holding it. Empty shows
+	// the whole block.
+	Snippet string `env:"SNIPPET"`
+	// GroupByDocument collapses matching blocks under their document.
+	GroupByDocument bool `env:"GROUP_BY_DOCUMENT" envDefault:"false"`
+	// PerSpaceTimeoutMS bounds each query on a single space, so that a slow
+	// or locked space is skipped instead of delaying the others.
+	PerSpaceTimeoutMS int `env:"PER_SPACE_TIMEOUT_MS" envDefault:"0"`
+	// SQLiteCacheSize is the page cache of every index connection, in pages,
+	// or in KiB when negative. Zero keeps the sqlite default.
+	SQLiteCacheSize int `env:"SQLITE_CACHE_SIZE" envDefault:"-16384"`
+	// SQLiteMmapSize is the number of bytes of an index read through memory
+	// mapping. Zero keeps the sqlite default.
+	SQLiteMmapSize int64 `env:"SQLITE_MMAP_SIZE" envDefault:"268435456"`
+	// StarredOnly restricts results to starred documents and their blocks.
+	StarredOnly bool `env:"STARRED_ONLY" envDefault:"false"`
+	// RawMatch searches for the query exactly as typed, including markdown
+	// such as code fences or checkbox markers. Query tokens, #tags and the
+	// splitting into words are not applied, and neither is any folding of the
+	// content such as diacritic folding.
+	RawMatch bool `env:"RAW_MATCH" envDefault:"false"`
+	// SymbolSearch searches for a query of symbols only, such as "---",
+	// literally as with RawMatch. By default such a query asks for text.
+	SymbolSearch bool `env:"SYMBOL_SEARCH" envDefault:"false"`
+	// FoldDiacritics ignores the diacritics of Latin letters when matching,
+	// so that "cafe" finds "café". Other scripts are not affected.
+	FoldDiacritics bool `env:"FOLD_DIACRITICS" envDefault:"false"`
+	// DefaultFolderID is the folder new documents are created in. Empty
+	// creates them at the root of the space.
+	DefaultFolderID string `env:"DEFAULT_FOLDER_ID"`
+	// MaxSpaces caps the number of search indexes opened per query. The
+	// primary space and the most recently modified indexes are kept.
+	MaxSpaces int `env:"MAX_SPACES" envDefault:"32"`
+	// Outline lists the matching blocks under a header item of their
+	// document, in the order the documents rank.
+	Outline bool `env:"OUTLINE" envDefault:"false"`
+	// Reverse lists the results least relevant first, for reviewing them.
+	Reverse bool `env:"REVERSE" envDefault:"false"`
+	// ExcludeCurrentDocumentBlocks also drops the blocks of the document the
+	// search was started from, not only the document itself.
+	ExcludeCurrentDocumentBlocks bool `env:"EXCLUDE_CURRENT_DOCUMENT_BLOCKS" envDefault:"false"`
+	// RecencyWeight ranks newer documents above older ones of the same match
+	// quality. It is the penalty per year of age; zero keeps the index order.
+	RecencyWeight float64 `env:"RECENCY_WEIGHT" envDefault:"0"`
+	// RecentBy orders the recent documents of an empty query by the time they
+	// were last "modified" or by the time they were "created".
+	RecentBy string `env:"RECENT_BY" envDefault:"modified"`
+	// SortBy orders the results by "relevance", or by the time their
+	// documents were last "modified", newest first.
+	SortBy string `env:"SORT_BY" envDefault:"relevance"`
+	// ModifiedColumn names the column of the search index holding the
+	// modification time, for Craft versions whose name is not recognized.
+	ModifiedColumn string `env:"MODIFIED_COLUMN"`
+	// DocPriority ranks documents against blocks: "strict" lists every
+	// document before any block, "relevance" prefers a document only over
+	// blocks that match equally well.
+	DocPriority string `env:"DOC_PRIORITY" envDefault:"relevance"`
+	// Redact hashes paths, space IDs and text settings in the exported
+	// configuration, see Export.
+	Redact bool `env:"REDACT" envDefault:"false"`
+	// SpaceIcons maps space IDs to icon files, as "space:path,space:path".
+	// Relative paths are resolved against the workflow directory.
+	SpaceIcons map[string]string `env:"SPACE_ICONS"`
+	// SpaceNames maps space IDs to names, as "space:name,space:name". The
+	// `space:` token matches them.
+	SpaceNames map[string]string `env:"SPACE_NAMES"`
+	// SpaceAliases maps short aliases to space IDs, as "alias:space". An
+	// alias stands for its space wherever a space is configured or typed.
+	SpaceAliases map[string]string `env:"SPACE_ALIASES"`
+	// Macros maps names to saved queries, as "name=query;name=query", since
+	// queries may hold colons and commas. `@name` in a query expands to the
+	// saved one.
+	Macros map[string]string `env:"MACROS" envSeparator:";" envKeyValSeparator:"="`
+	// Profiles defines the bundles of settings the profile variable selects,
+	// as "name=key:value,key:value;name=...", see Profile. They add to and
+	// replace the built-in profiles.
+	Profiles map[string]string `env:"PROFILES" envSeparator:";" envKeyValSeparator:"="`
+	// TitleWeight is how much more a query word counts when it matches a
+	// document title rather than block content. A block counts the words
+	// matching the title of its document.
+	TitleWeight float64 `env:"TITLE_WEIGHT" envDefault:"2"`
+	// LinkTarget selects where results open: "desktop" or "web".
+	LinkTarget string `env:"LINK_TARGET" envDefault:"desktop"`
+	// WebLinkTemplate builds web links for LINK_TARGET=web from the
+	// {spaceId}, {documentId} and {blockId} placeholders.
+	WebLinkTemplate string `env:"WEB_LINK_TEMPLATE"`
+	// JoinedMatch finds documents whose query words are spread over several
+	// blocks. It is capped per search, as each document costs a query.
+	JoinedMatch bool `env:"JOINED_MATCH" envDefault:"false"`
+	// PrimarySpace overrides the primary space detected from the index file
+	// names.
+	PrimarySpace string `env:"PRIMARY_SPACE"`
+	// Subsequence falls back to document titles holding the query characters
+	// in order, so that "prjpln" finds "Project Plan".
+	Subsequence bool `env:"SUBSEQUENCE" envDefault:"false"`
+	// Acronym finds document titles by the initials of their words, so that
+	// "prd" finds "Product Requirements Doc".
+	Acronym bool `env:"ACRONYM" envDefault:"false"`
+	// NumericBoundary ranks numbers standing on their own, such as the year
+	// in "2024.01.05", above numbers embedded in longer ones.
+	NumericBoundary bool `env:"NUMERIC_BOUNDARY" envDefault:"false"`
+	// MaxSubtitleLen cuts result subtitles to this many characters, zero
+	// leaves them whole.
+	MaxSubtitleLen int `env:"MAX_SUBTITLE_LEN" envDefault:"0"`
+	// BodyOnly searches block content only, leaving out documents that
+	// would match by their title.
+	BodyOnly bool `env:"BODY_ONLY" envDefault:"false"`
+	// DocumentsOnly searches document titles only, leaving out blocks.
+	DocumentsOnly bool `env:"DOCUMENTS_ONLY" envDefault:"false"`
+	// QueryCacheTTL is how long the results of a query are reused while the
+	// search indexes stay unchanged, such as "30s". Zero disables reuse.
+	QueryCacheTTL time.Duration `env:"QUERY_CACHE_TTL" envDefault:"0"`
+	// HighlightBlock asks Craft to highlight the opened block after
+	// scrolling to it.
+	HighlightBlock bool `env:"HIGHLIGHT_BLOCK" envDefault:"false"`
+	// MergeBlocks shows a document with several matching blocks once, with
+	// its top block. The blocks are listed by searching within the document.
+	MergeBlocks bool `env:"MERGE_BLOCKS" envDefault:"false"`
+	// WordPassThreshold skips searching for single words in a space once the
+	// full query found this many candidates there. Zero disables the skip.
+	WordPassThreshold int `env:"WORD_PASS_THRESHOLD" envDefault:"0"`
+	// MaxWordPasses caps the single-word searches of a multi-word query,
+	// counting one per word and space. Zero disables the cap.
+	MaxWordPasses int `env:"MAX_WORD_PASSES" envDefault:"50"`
+	// ResultLimit is the number of results shown.
+	ResultLimit int `env:"RESULT_LIMIT" envDefault:"40"`
+	// FetchLimit is the number of candidates read from a space per query, at
+	// least ResultLimit.
+	FetchLimit int `env:"FETCH_LIMIT" envDefault:"200"`
+	// DisablePhrasePass skips searching for all the words of a query at once,
+	// for tuning the ranking.
+	DisablePhrasePass bool `env:"DISABLE_PHRASE_PASS" envDefault:"false"`
+	// DisableWordPass skips searching for every word of a query alone. At
+	// most one of the passes may be disabled.
+	DisableWordPass bool `env:"DISABLE_WORD_PASS" envDefault:"false"`
+	// MatchRatio is the fraction of the query words a result must contain,
+	// greater than 0 and at most 1. Results with more words matched rank
+	// higher.
+	MatchRatio float64 `env:"MATCH_RATIO" envDefault:"1"`
+	// ClusterByDoc keeps the results of a document together within results
+	// of the same match quality, ordering the documents by title.
+	ClusterByDoc bool `env:"CLUSTER_BY_DOC" envDefault:"false"`
+	// CreateOnNoResults offers to create a document named after a query
+	// that found nothing.
+	CreateOnNoResults bool `env:"CREATE_ON_NO_RESULTS" envDefault:"true"`
+	// CheckCraftRunning notes on create actions when Craft is not running,
+	// as it is launched by the action then. It costs a pgrep per query.
+	CheckCraftRunning bool `env:"CHECK_CRAFT_RUNNING" envDefault:"false"`
+	// EarlyMatch ranks results matching near the start of their content
+	// above those matching further in, at equal match quality.
+	EarlyMatch bool `env:"EARLY_MATCH" envDefault:"false"`
+	// ShowHeading adds the heading a block is under to its subtitle. It
+	// costs a query per document in the results.
+	ShowHeading bool `env:"SHOW_HEADING" envDefault:"false"`
+	// CaptureDocumentID is the document the capture keyword appends to. Today's
+	// daily note is used when empty.
+	CaptureDocumentID string `env:"CAPTURE_DOCUMENT_ID"`
+	// KeepTitleBlocks keeps block results repeating the title of their
+	// document, which are dropped in favor of the document by default.
+	KeepTitleBlocks bool `env:"KEEP_TITLE_BLOCKS" envDefault:"false"`
+	// ShowTimings adds an item with the time spent loading the config,
+	// querying each space, scoring and backfilling document names.
+	ShowTimings bool `env:"SHOW_TIMINGS" envDefault:"false"`
+	indexes     []SearchIndex
 }
 
 func (c *Config) SearchIndexes() []SearchIndex {
 	return c.indexes
 }
 
+// PrimarySpaceID returns the configured PRIMARY_SPACE, or else the space whose
+// index file is named after it alone, without `||`. The first discovered space
+// is the last resort.
+func (c *Config) PrimarySpaceID() string {
+	if c.PrimarySpace != "" {
+		return c.PrimarySpace
+	}
+
+	for _, si := range c.indexes {
+		if si.primary {
+			return si.SpaceID
+		}
+	}
+
+	if len(c.indexes) > 0 {
+		return c.indexes[0].SpaceID
+	}
+	return ""
+}
+
+// HasSpace reports whether a search index was discovered for the space.
+func (c *Config) HasSpace(spaceID string) bool {
+	for _, si := range c.indexes {
+		if si.SpaceID == spaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSpaceAlias returns the space ID an alias stands for, or the given
+// value when it is no alias.
+func (c *Config) ResolveSpaceAlias(value string) string {
+	if spaceID, ok := c.SpaceAliases[value]; ok {
+		return spaceID
+	}
+	return value
+}
+
+// SpaceName returns the name configured for the space, or "" when none is.
+func (c *Config) SpaceName(spaceID string) string {
+	return c.SpaceNames[spaceID]
+}
+
+// SpaceIcon returns the icon file configured for the space, or "" when none
+// is configured or the file does not exist.
+func (c *Config) SpaceIcon(spaceID string) string {
+	path, ok := c.SpaceIcons[spaceID]
+	if !ok || path == "" {
+		return ""
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Icon of space %s is unavailable: %v", spaceID, err)
+		return ""
+	}
+
+	return path
+}
+
+// IndexModTime returns the latest modification of the search index files,
+// including their write-ahead logs. It stats the files on every call, the
+// discovered modification times may come from the cache.
+func (c *Config) IndexModTime() time.Time {
+	var latest time.Time
+	for _, si := range c.indexes {
+		for _, path := range []string{si.Path(), si.Path() + "-wal"} {
+			if fi, err := os.Stat(path); err == nil && fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+	}
+	return latest
+}
+
 func (c *Config) MainDBPath() string {
 	homeDir := os.Getenv("HOME")
 	return filepath.Join(homeDir, "Library/Containers/com.lukilabs.lukiapp/Data/Library/Application Support/com.lukilabs.lukiapp/LukiMain_dbf93b0b-3c55-5ab0-745b-9fa6a60fc3d2_999609FB-390A-496E-9AA3-2F9B55D6C43C.realm")
 }
 
-func NewConfig() (*Config, error) {
+// Default limits used when RESULT_LIMIT and FETCH_LIMIT are invalid.
+const (
+	defaultResultLimit = 40
+	defaultFetchLimit  = 200
+)
+
+// IndexCacheKey is the cache entry holding the discovered search indexes.
+const IndexCacheKey = "search_indexes.json"
+
+// IndexCache persists the discovered search indexes between invocations.
+// The workflow cache satisfies it.
+type IndexCache interface {
+	LoadJSON(name string, v interface{}) error
+	StoreJSON(name string, v interface{}) error
+}
+
+type cachedIndex struct {
+	SpaceID string
+	Name    string
+	Primary bool
+	ModTime time.Time
+}
+
+type cachedIndexes struct {
+	Dir     string
+	ModTime time.Time
+	Indexes []cachedIndex
+}
+
+// loadCachedIndexes returns the cached indexes if they were discovered in the
+// same directory and the directory has not changed since.
+func loadCachedIndexes(cache IndexCache, dir string, modTime time.Time) ([]SearchIndex, bool) {
+	var cached cachedIndexes
+	if err := cache.LoadJSON(IndexCacheKey, &cached); err != nil {
+		return nil, false
+	}
+
+	if cached.Dir != dir || !cached.ModTime.Equal(modTime) || len(cached.Indexes) == 0 {
+		return nil, false
+	}
+
+	indexes := make([]SearchIndex, 0, len(cached.Indexes))
+	for _, ci := range cached.Indexes {
+		indexes = append(indexes, SearchIndex{SpaceID: ci.SpaceID, name: ci.Name, dir: dir, primary: ci.Primary, modTime: ci.ModTime})
+	}
+	return indexes, true
+}
+
+func storeCachedIndexes(cache IndexCache, dir string, modTime time.Time, indexes []SearchIndex) {
+	cached := cachedIndexes{Dir: dir, ModTime: modTime}
+	for _, si := range indexes {
+		cached.Indexes = append(cached.Indexes, cachedIndex{SpaceID: si.SpaceID, Name: si.name, Primary: si.primary, ModTime: si.modTime})
+	}
+
+	if err := cache.StoreJSON(IndexCacheKey, cached); err != nil {
+		log.Printf("Storing search index cache failed: %v", err)
+	}
+}
+
+// capIndexes keeps at most max indexes, preferring the primary space and
+// then the most recently modified indexes. Kept indexes stay in their
+// discovery order. A max of zero or less disables the cap.
+func capIndexes(indexes []SearchIndex, max int) []SearchIndex {
+	if max <= 0 || len(indexes) <= max {
+		return indexes
+	}
+
+	ranked := make([]int, len(indexes))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := indexes[ranked[i]], indexes[ranked[j]]
+		if a.primary != b.primary {
+			return a.primary
+		}
+		return a.modTime.After(b.modTime)
+	})
+
+	keep := make(map[int]bool, max)
+	for _, i := range ranked[:max] {
+		keep[i] = true
+	}
+
+	capped := make([]SearchIndex, 0, max)
+	for i, si := range indexes {
+		if keep[i] {
+			capped = append(capped, si)
+		} else {
+			log.Printf("MAX_SPACES=%d reached, skipping search index %s", max, si.name)
+		}
+	}
+	return capped
+}
+
+// NewConfig reads the configuration from the environment and discovers the
+// search indexes. When cache is not nil, the discovered indexes are reused
+// until the index directory changes.
+func NewConfig(cache IndexCache) (*Config, error) {
 	var config Config
 	if err := env.Parse(&config); err != nil {
-		return nil, fmt.Errorf("parse: %w", err)
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("parse: %w", err))
+	}
+
+	if config.RecentBy != "modified" && config.RecentBy != "created" {
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("RECENT_BY must be modified or created, not %q", config.RecentBy))
+	}
+
+	if config.SortBy != "relevance" && config.SortBy != "modified" {
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("SORT_BY must be relevance or modified, not %q", config.SortBy))
+	}
+
+	if config.DocPriority != "strict" && config.DocPriority != "relevance" {
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("DOC_PRIORITY must be strict or relevance, not %q", config.DocPriority))
+	}
+
+	if config.Snippet != "" && config.Snippet != "window" && config.Snippet != "sentence" {
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("SNIPPET must be window or sentence, not %q", config.Snippet))
+	}
+
+	if config.ResultLimit <= 0 || config.FetchLimit <= 0 || config.FetchLimit < config.ResultLimit {
+		log.Printf("Invalid RESULT_LIMIT %d and FETCH_LIMIT %d, using %d and %d", config.ResultLimit, config.FetchLimit, defaultResultLimit, defaultFetchLimit)
+		config.ResultLimit, config.FetchLimit = defaultResultLimit, defaultFetchLimit
+	}
+
+	if config.MatchRatio <= 0 || config.MatchRatio > 1 {
+		return nil, types.NewConfigError("Invalid workflow configuration", fmt.Errorf("MATCH_RATIO must be greater than 0 and at most 1, not %v", config.MatchRatio))
+	}
+
+	if config.BodyOnly && config.DocumentsOnly {
+		return nil, types.NewConfigError("Invalid workflow configuration", errors.New("BODY_ONLY and DOCUMENTS_ONLY cannot both be set"))
 	}
 
+	if config.DisablePhrasePass && config.DisableWordPass {
+		return nil, types.NewConfigError("Invalid workflow configuration", errors.New("DISABLE_PHRASE_PASS and DISABLE_WORD_PASS cannot both be set"))
+	}
+
+	config.PrimarySpace = config.ResolveSpaceAlias(config.PrimarySpace)
+	config.DefaultCreateSpace = config.ResolveSpaceAlias(config.DefaultCreateSpace)
+
 	if strings.HasPrefix(config.IndexPathDir, "~/") {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -53,13 +442,33 @@ func NewConfig() (*Config, error) {
 		}
 
 		config.IndexPathDir = strings.Replace(config.IndexPathDir, "~", homeDir, 1)
+
+		// Without an explicit INDEX_PATH_DIR, follow a non-default install
+		if _, explicit := os.LookupEnv("INDEX_PATH_DIR"); !explicit && !hasSearchIndex(config.IndexPathDir) {
+			if dir := discoverIndexDir(homeDir); dir != "" {
+				config.IndexPathDir = dir
+			}
+		}
+	}
+
+	info, err := os.Stat(config.IndexPathDir)
+	if err != nil {
+		return nil, types.NewConfigError("Search index directory unavailable", fmt.Errorf("stat dir: %w", err))
+	}
+
+	if cache != nil {
+		if indexes, ok := loadCachedIndexes(cache, config.IndexPathDir, info.ModTime()); ok {
+			config.indexes = capIndexes(indexes, config.MaxSpaces)
+			return &config, nil
+		}
 	}
 
 	entries, err := os.ReadDir(config.IndexPathDir)
 	if err != nil {
-		return nil, fmt.Errorf("read dir: %w", err)
+		return nil, types.NewConfigError("Search index directory unavailable", fmt.Errorf("read dir: %w", err))
 	}
 
+	seenSpaces := make(map[string]int)
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -72,17 +481,47 @@ func NewConfig() (*Config, error) {
 			}
 			spacePart := match[1]
 			spaceIDs := strings.Split(spacePart, "||")
-			config.indexes = append(config.indexes, SearchIndex{
+			si := SearchIndex{
 				SpaceID: spaceIDs[len(spaceIDs)-1],
 				name:    entry.Name(),
 				dir:     config.IndexPathDir,
-			})
+				primary: len(spaceIDs) == 1,
+			}
+			if fi, err := entry.Info(); err == nil {
+				si.modTime = fi.ModTime()
+			}
+
+			// Case-insensitive file systems may hold the same space under
+			// differently cased names, keep the most recently modified one.
+			key := strings.ToLower(si.SpaceID)
+			if i, ok := seenSpaces[key]; ok {
+				kept := config.indexes[i]
+				if si.modTime.After(kept.modTime) {
+					config.indexes[i], kept = si, config.indexes[i]
+				}
+				log.Printf("Search indexes %s and %s belong to the same space, using %s", kept.name, si.name, config.indexes[i].name)
+				continue
+			}
+			seenSpaces[key] = len(config.indexes)
+			config.indexes = append(config.indexes, si)
 		}
 	}
 
 	if len(config.indexes) == 0 {
-		return nil, errors.New("no index files found")
+		// Craft keeps its documents in a Realm database, which cannot be read
+		// without its SDK. Only the search indexes are searchable, and Craft
+		// rebuilds them when it runs.
+		if _, err := os.Stat(config.MainDBPath()); err == nil {
+			return nil, types.NewTransientError("Open Craft to rebuild the search indexes", errors.New("no index files found, Craft rebuilds them while it is open"))
+		}
+		return nil, types.NewConfigError("No search indexes", errors.New("no index files found"))
 	}
 
+	if cache != nil {
+		storeCachedIndexes(cache, config.IndexPathDir, info.ModTime(), config.indexes)
+	}
+
+	config.indexes = capIndexes(config.indexes, config.MaxSpaces)
+
 	return &config, nil
 }
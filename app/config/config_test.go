@@ -0,0 +1,502 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// setEnv sets an environment variable for the duration of the test.
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, had := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// writeIndexes creates an empty search index file for each of the index
+// names, such as "s1" or "s1||s2".
+func writeIndexes(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, "SearchIndex_"+name+".sqlite"), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// memoryCache is an IndexCache keeping its entries in memory.
+type memoryCache map[string][]byte
+
+func (c memoryCache) LoadJSON(name string, v interface{}) error {
+	data, ok := c[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c memoryCache) StoreJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c[name] = data
+	return nil
+}
+
+func spaceIDs(indexes []SearchIndex) []string {
+	ids := make([]string, 0, len(indexes))
+	for _, si := range indexes {
+		ids = append(ids, si.SpaceID)
+	}
+	return ids
+}
+
+func TestNewConfigIndexCache(t *testing.T) {
+	dir := t.TempDir()
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	writeIndexes(t, dir, "s1")
+
+	cache := memoryCache{}
+	if _, err := NewConfig(cache); err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	if _, ok := cache[IndexCacheKey]; !ok {
+		t.Fatal("NewConfig() did not cache the discovered indexes")
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new index that leaves the directory time unchanged is not rescanned
+	writeIndexes(t, dir, "s1||s2")
+	if err := os.Chtimes(dir, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewConfig(cache)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	if got := spaceIDs(cfg.SearchIndexes()); len(got) != 1 || got[0] != "s1" {
+		t.Errorf("cache hit found spaces %v, want the cached [s1]", got)
+	}
+	if si := cfg.SearchIndexes()[0]; si.Path() != filepath.Join(dir, "SearchIndex_s1.sqlite") {
+		t.Errorf("cached index path = %q", si.Path())
+	}
+
+	// A changed directory invalidates the cache
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(dir, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = NewConfig(cache)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	if got := spaceIDs(cfg.SearchIndexes()); len(got) != 2 {
+		t.Errorf("rescan found spaces %v, want [s1 s2]", got)
+	}
+}
+
+func TestLoadCachedIndexesOtherDir(t *testing.T) {
+	modTime := time.Now()
+	cache := memoryCache{}
+	storeCachedIndexes(cache, "/one", modTime, []SearchIndex{{SpaceID: "s1", name: "SearchIndex_s1.sqlite", dir: "/one"}})
+
+	if _, ok := loadCachedIndexes(cache, "/two", modTime); ok {
+		t.Error("loadCachedIndexes() used indexes cached for another directory")
+	}
+	if indexes, ok := loadCachedIndexes(cache, "/one", modTime); !ok || len(indexes) != 1 {
+		t.Errorf("loadCachedIndexes() = %v, %t, want the cached index", indexes, ok)
+	}
+}
+
+func TestNewConfigMaxSpaces(t *testing.T) {
+	dir := t.TempDir()
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "MAX_SPACES", "2")
+	writeIndexes(t, dir, "p", "p||old", "p||new", "p||older")
+
+	// The primary index is the oldest, it is kept anyway
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"p", "p||older", "p||old", "p||new"} {
+		modTime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, "SearchIndex_"+name+".sqlite"), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	if got, want := spaceIDs(cfg.SearchIndexes()), []string{"p", "new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spaces = %v, want the primary and the most recent %v", got, want)
+	}
+}
+
+func TestCapIndexes(t *testing.T) {
+	now := time.Now()
+	indexes := []SearchIndex{
+		{SpaceID: "a", modTime: now.Add(-3 * time.Hour)},
+		{SpaceID: "b", modTime: now},
+		{SpaceID: "p", primary: true, modTime: now.Add(-5 * time.Hour)},
+		{SpaceID: "c", modTime: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		max  int
+		want []string
+	}{
+		{max: 0, want: []string{"a", "b", "p", "c"}},
+		{max: 10, want: []string{"a", "b", "p", "c"}},
+		{max: 1, want: []string{"p"}},
+		{max: 3, want: []string{"b", "p", "c"}},
+	}
+
+	for _, tt := range tests {
+		if got := spaceIDs(capIndexes(indexes, tt.max)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("capIndexes(%d) = %v, want %v", tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestSpaceIcon(t *testing.T) {
+	dir := t.TempDir()
+	icon := filepath.Join(dir, "work.png")
+	if err := os.WriteFile(icon, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "SPACE_ICONS", "s1:"+icon+",s2:"+filepath.Join(dir, "missing.png"))
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		spaceID string
+		want    string
+	}{
+		{"s1", icon},
+		{"s2", ""},
+		{"s3", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.SpaceIcon(tt.spaceID); got != tt.want {
+			t.Errorf("SpaceIcon(%q) = %q, want %q", tt.spaceID, got, tt.want)
+		}
+	}
+}
+
+func TestPrimarySpaceID(t *testing.T) {
+	tests := []struct {
+		name    string
+		indexes []string
+		primary string
+		want    string
+	}{
+		{name: "secondary listed first", indexes: []string{"a||b", "a||c", "a"}, want: "a"},
+		{name: "no index named alone", indexes: []string{"a||b", "a||c"}, want: "b"},
+		{name: "configured", indexes: []string{"a", "a||b"}, primary: "b", want: "b"},
+		{name: "configured alias", indexes: []string{"a", "a||b"}, primary: "work", want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeIndexes(t, dir, tt.indexes...)
+			setEnv(t, "INDEX_PATH_DIR", dir)
+			setEnv(t, "PRIMARY_SPACE", tt.primary)
+			setEnv(t, "SPACE_ALIASES", "work:b")
+
+			cfg, err := NewConfig(nil)
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+			if got := cfg.PrimarySpaceID(); got != tt.want {
+				t.Errorf("PrimarySpaceID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfigCaseDifferingIndexes(t *testing.T) {
+	dir := t.TempDir()
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	writeIndexes(t, dir, "a", "a||Foo", "a||foo")
+
+	// The lowercase index is the more recent one
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "SearchIndex_a||Foo.sqlite"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	if got, want := spaceIDs(cfg.SearchIndexes()), []string{"a", "foo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spaces = %v, want one entry per space %v", got, want)
+	}
+}
+
+func TestNewConfigNoIndexes(t *testing.T) {
+	tests := []struct {
+		name   string
+		mainDB bool
+		want   types.Category
+	}{
+		{name: "Craft not opened since the indexes went missing", mainDB: true, want: types.Transient},
+		{name: "no Craft database", want: types.Config},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "INDEX_PATH_DIR", t.TempDir())
+			setEnv(t, "HOME", t.TempDir())
+
+			cfg := Config{}
+			if tt.mainDB {
+				path := cfg.MainDBPath()
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := NewConfig(nil)
+
+			var typed types.Error
+			if !errors.As(err, &typed) || typed.Category != tt.want {
+				t.Errorf("NewConfig() error = %v, want category %v", err, tt.want)
+			}
+			if tt.mainDB && !strings.HasPrefix(typed.Title, "Open Craft") {
+				t.Errorf("NewConfig() error title = %q, want it to ask to open Craft", typed.Title)
+			}
+		})
+	}
+}
+
+func TestSpaceAliases(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "1111", "1111||2222")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "SPACE_ALIASES", "w:1111,h:2222")
+	setEnv(t, "PRIMARY_SPACE", "h")
+	setEnv(t, "DEFAULT_CREATE_SPACE", "w")
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	if cfg.PrimarySpace != "2222" {
+		t.Errorf("PrimarySpace = %q, want the aliased space", cfg.PrimarySpace)
+	}
+	if cfg.DefaultCreateSpace != "1111" {
+		t.Errorf("DefaultCreateSpace = %q, want the aliased space", cfg.DefaultCreateSpace)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"w", "1111"},
+		{"h", "2222"},
+		{"3333", "3333"},
+		{"x", "x"},
+	}
+	for _, tt := range tests {
+		if got := cfg.ResolveSpaceAlias(tt.value); got != tt.want {
+			t.Errorf("ResolveSpaceAlias(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewConfigMacros(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "MACROS", "okr=folder:goals #okr;plan=road map")
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	want := map[string]string{"okr": "folder:goals #okr", "plan": "road map"}
+	if !reflect.DeepEqual(cfg.Macros, want) {
+		t.Errorf("Macros = %q, want %q", cfg.Macros, want)
+	}
+}
+
+func TestNewConfigDisableBothPasses(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "DISABLE_PHRASE_PASS", "true")
+
+	tests := []struct {
+		disableWordPass string
+		wantErr         bool
+	}{
+		{disableWordPass: "false", wantErr: false},
+		{disableWordPass: "true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		setEnv(t, "DISABLE_WORD_PASS", tt.disableWordPass)
+
+		_, err := NewConfig(nil)
+
+		var typed types.Error
+		if tt.wantErr && (!errors.As(err, &typed) || typed.Category != types.Config) {
+			t.Errorf("DISABLE_WORD_PASS=%s NewConfig() error = %v, want a configuration error", tt.disableWordPass, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("DISABLE_WORD_PASS=%s NewConfig() error = %v", tt.disableWordPass, err)
+		}
+	}
+}
+
+func TestNewConfigDocPriority(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+
+	for _, priority := range []string{"strict", "relevance"} {
+		setEnv(t, "DOC_PRIORITY", priority)
+		if cfg, err := NewConfig(nil); err != nil || cfg.DocPriority != priority {
+			t.Errorf("DOC_PRIORITY=%s NewConfig() = %v, %v", priority, cfg, err)
+		}
+	}
+
+	setEnv(t, "DOC_PRIORITY", "documents")
+	var typed types.Error
+	if _, err := NewConfig(nil); !errors.As(err, &typed) || typed.Category != types.Config {
+		t.Errorf("DOC_PRIORITY=documents NewConfig() error = %v, want a configuration error", err)
+	}
+}
+
+func TestNewConfigMatchRatio(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+
+	tests := []struct {
+		ratio   string
+		wantErr bool
+	}{
+		{ratio: "1"},
+		{ratio: "0.5"},
+		{ratio: "0.01"},
+		{ratio: "0", wantErr: true},
+		{ratio: "-0.5", wantErr: true},
+		{ratio: "1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		setEnv(t, "MATCH_RATIO", tt.ratio)
+
+		cfg, err := NewConfig(nil)
+
+		var typed types.Error
+		if tt.wantErr && (!errors.As(err, &typed) || typed.Category != types.Config) {
+			t.Errorf("MATCH_RATIO=%s NewConfig() error = %v, want a configuration error", tt.ratio, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("MATCH_RATIO=%s NewConfig() error = %v", tt.ratio, err)
+		}
+		if !tt.wantErr && err == nil && fmt.Sprint(cfg.MatchRatio) != tt.ratio {
+			t.Errorf("MATCH_RATIO=%s NewConfig() MatchRatio = %v", tt.ratio, cfg.MatchRatio)
+		}
+	}
+}
+
+func TestNewConfigLimits(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+
+	tests := []struct {
+		name                    string
+		resultLimit, fetchLimit string
+		wantResult, wantFetch   int
+	}{
+		{name: "configured", resultLimit: "50", fetchLimit: "300", wantResult: 50, wantFetch: 300},
+		{name: "fetch as many as shown", resultLimit: "50", fetchLimit: "50", wantResult: 50, wantFetch: 50},
+		{name: "fetch below result limit", resultLimit: "50", fetchLimit: "20", wantResult: defaultResultLimit, wantFetch: defaultFetchLimit},
+		{name: "zero result limit", resultLimit: "0", fetchLimit: "300", wantResult: defaultResultLimit, wantFetch: defaultFetchLimit},
+		{name: "negative fetch limit", resultLimit: "50", fetchLimit: "-1", wantResult: defaultResultLimit, wantFetch: defaultFetchLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "RESULT_LIMIT", tt.resultLimit)
+			setEnv(t, "FETCH_LIMIT", tt.fetchLimit)
+
+			cfg, err := NewConfig(nil)
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+			if cfg.ResultLimit != tt.wantResult || cfg.FetchLimit != tt.wantFetch {
+				t.Errorf("NewConfig() limits = %d, %d, want %d, %d", cfg.ResultLimit, cfg.FetchLimit, tt.wantResult, tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestNewConfigSortBy(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+
+	for _, sortBy := range []string{"relevance", "modified"} {
+		setEnv(t, "SORT_BY", sortBy)
+		cfg, err := NewConfig(nil)
+		if err != nil || cfg.SortBy != sortBy {
+			t.Errorf("SORT_BY=%s NewConfig() = %v, %v", sortBy, cfg, err)
+			continue
+		}
+		// Without MODIFIED_COLUMN the column is looked up by its known names
+		if cfg.ModifiedColumn != "" {
+			t.Errorf("SORT_BY=%s NewConfig() ModifiedColumn = %q, want it unset", sortBy, cfg.ModifiedColumn)
+		}
+	}
+
+	setEnv(t, "SORT_BY", "newest")
+	var typed types.Error
+	if _, err := NewConfig(nil); !errors.As(err, &typed) || typed.Category != types.Config {
+		t.Errorf("SORT_BY=newest NewConfig() error = %v, want a configuration error", err)
+	}
+}
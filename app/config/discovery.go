@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// craftContainers are the sandbox containers of the Craft editions, the
+// direct download one first.
+var craftContainers = []string{"com.lukilabs.lukiapp", "com.lukilabs.lukiapp-setapp"}
+
+// discoverIndexDir looks for the search index directory of a Craft install
+// that does not use the default location. Directories named in Craft's
+// preferences come first, then the default directory of every edition.
+// It returns "" when none holds a search index.
+func discoverIndexDir(homeDir string) string {
+	var candidates []string
+	for _, container := range craftContainers {
+		prefs := filepath.Join(homeDir, "Library/Containers", container, "Data/Library/Preferences", container+".plist")
+		candidates = append(candidates, preferenceDirs(prefs)...)
+	}
+	for _, container := range craftContainers {
+		candidates = append(candidates, filepath.Join(homeDir, "Library/Containers", container, "Data/Library/Application Support", container, "Search"))
+	}
+
+	for _, dir := range candidates {
+		if hasSearchIndex(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// preferenceDirs returns the paths named in the preferences file. The file
+// may be a binary plist, so plutil converts it first. Missing or unreadable
+// preferences yield nothing.
+func preferenceDirs(path string) []string {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	out, err := exec.Command("plutil", "-convert", "xml1", "-o", "-", path).Output()
+	if err != nil {
+		log.Printf("Reading Craft preferences %s failed: %v", path, err)
+		return nil
+	}
+
+	return plistPaths(out)
+}
+
+// plistPaths returns the string values of an XML plist that look like
+// absolute paths or file URLs.
+func plistPaths(data []byte) []string {
+	var paths []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	inString := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return paths
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			inString = t.Name.Local == "string"
+		case xml.EndElement:
+			inString = false
+		case xml.CharData:
+			if !inString {
+				continue
+			}
+			value := strings.TrimPrefix(strings.TrimSpace(string(t)), "file://")
+			if strings.HasPrefix(value, "/") {
+				paths = append(paths, filepath.Clean(value))
+			}
+		}
+	}
+}
+
+// hasSearchIndex reports whether dir holds at least one search index file.
+func hasSearchIndex(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && regexIndexName.MatchString(entry.Name()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>/not/a/value</key>
+	<string>light</string>
+	<key>SearchIndexLocation</key>
+	<string>file:///Volumes/Data/Craft/Search/</string>
+	<key>LastExportDir</key>
+	<string> /Users/me/Exports </string>
+	<key>Count</key>
+	<integer>3</integer>
+</dict>
+</plist>
+`
+
+func TestPlistPaths(t *testing.T) {
+	want := []string{"/Volumes/Data/Craft/Search", "/Users/me/Exports"}
+	if got := plistPaths([]byte(testPlist)); !reflect.DeepEqual(got, want) {
+		t.Errorf("plistPaths() = %q, want %q", got, want)
+	}
+
+	if got := plistPaths([]byte("bplist00 not xml")); len(got) != 0 {
+		t.Errorf("plistPaths() of unreadable data = %q, want none", got)
+	}
+}
+
+// fakePlutil puts a plutil on PATH that prints the file it converts as is.
+func fakePlutil(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\n# plutil -convert xml1 -o - <path>\ncat \"$5\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "plutil"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDiscoverIndexDirFromPreferences(t *testing.T) {
+	fakePlutil(t)
+	home := t.TempDir()
+
+	indexDir := filepath.Join(t.TempDir(), "Craft Search")
+	if err := os.MkdirAll(indexDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexes(t, indexDir, "s1")
+
+	// The default location holds an index too, the preferences win
+	defaultDir := filepath.Join(home, "Library/Containers/com.lukilabs.lukiapp/Data/Library/Application Support/com.lukilabs.lukiapp/Search")
+	if err := os.MkdirAll(defaultDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexes(t, defaultDir, "s2")
+
+	prefsDir := filepath.Join(home, "Library/Containers/com.lukilabs.lukiapp-setapp/Data/Library/Preferences")
+	if err := os.MkdirAll(prefsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	prefs := "<plist><dict><key>SearchIndexLocation</key><string>file://" + indexDir + "</string></dict></plist>"
+	if err := os.WriteFile(filepath.Join(prefsDir, "com.lukilabs.lukiapp-setapp.plist"), []byte(prefs), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := discoverIndexDir(home); got != indexDir {
+		t.Errorf("discoverIndexDir() = %q, want the directory from the preferences %q", got, indexDir)
+	}
+}
+
+func TestDiscoverIndexDirDefaults(t *testing.T) {
+	home := t.TempDir()
+
+	if got := discoverIndexDir(home); got != "" {
+		t.Errorf("discoverIndexDir() without Craft = %q, want none", got)
+	}
+
+	// Unreadable preferences are skipped for the default directories
+	prefsDir := filepath.Join(home, "Library/Containers/com.lukilabs.lukiapp/Data/Library/Preferences")
+	if err := os.MkdirAll(prefsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefsDir, "com.lukilabs.lukiapp.plist"), []byte("bplist00"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setappDir := filepath.Join(home, "Library/Containers/com.lukilabs.lukiapp-setapp/Data/Library/Application Support/com.lukilabs.lukiapp-setapp/Search")
+	if err := os.MkdirAll(setappDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexes(t, setappDir, "s1")
+
+	if got := discoverIndexDir(home); got != setappDir {
+		t.Errorf("discoverIndexDir() = %q, want the Setapp default %q", got, setappDir)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// containersDir is the directory holding the app sandbox containers.
+const containersDir = "/Library/Containers/"
+
+// Export summarizes the effective configuration for a bug report: the index
+// directory, the spaces found in it and every setting given in the
+// environment. With REDACT set, the index directory past its container, the
+// space IDs and all text settings, which may name paths or IDs, are hashed.
+func (c *Config) Export() string {
+	hide := func(value string) string {
+		if !c.Redact || value == "" {
+			return value
+		}
+		sum := sha256.Sum256([]byte(value))
+		return "#" + hex.EncodeToString(sum[:])[:8]
+	}
+
+	var lines []string
+
+	indexDir := c.IndexPathDir
+	if homeDir, err := os.UserHomeDir(); err == nil && strings.HasPrefix(indexDir, homeDir) {
+		indexDir = "~" + strings.TrimPrefix(indexDir, homeDir)
+	}
+	// The container tells the Craft edition apart, anything past it is hashed
+	if i := strings.Index(indexDir, containersDir); c.Redact && i >= 0 {
+		rest := indexDir[i+len(containersDir):]
+		if j := strings.Index(rest, "/"); j >= 0 {
+			indexDir = indexDir[:i+len(containersDir)+j+1] + hide(rest[j+1:])
+		}
+	} else {
+		indexDir = hide(indexDir)
+	}
+	lines = append(lines, "INDEX_PATH_DIR="+indexDir)
+
+	spaceIDs := make([]string, 0, len(c.indexes))
+	for _, si := range c.indexes {
+		spaceIDs = append(spaceIDs, hide(si.SpaceID))
+	}
+	lines = append(lines, fmt.Sprintf("spaces (%d): %s", len(spaceIDs), strings.Join(spaceIDs, ", ")))
+
+	var settings []string
+	value := reflect.ValueOf(*c)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := field.Tag.Get("env")
+		if name == "" || name == "INDEX_PATH_DIR" {
+			continue
+		}
+		if _, set := os.LookupEnv(name); !set {
+			continue
+		}
+
+		setting := fmt.Sprintf("%v", value.Field(i).Interface())
+		switch field.Type.Kind() {
+		case reflect.String, reflect.Map, reflect.Slice:
+			setting = hide(setting)
+		}
+		settings = append(settings, name+"="+setting)
+	}
+	sort.Strings(settings)
+
+	return strings.Join(append(lines, settings...), "\n")
+}
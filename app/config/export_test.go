@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Library", "Containers", "com.lukilabs.lukiapp", "Data", "Search")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexes(t, dir, "1111", "1111||2222")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "RAW_MATCH", "true")
+	setEnv(t, "DEFAULT_FOLDER_ID", "folder-1")
+
+	tests := []struct {
+		name   string
+		redact string
+		want   []string
+		hidden []string
+	}{
+		{
+			name:   "plain",
+			redact: "false",
+			want: []string{
+				"INDEX_PATH_DIR=" + dir,
+				"spaces (2): 1111, 2222",
+				"RAW_MATCH=true",
+				"DEFAULT_FOLDER_ID=folder-1",
+				"REDACT=false",
+			},
+		},
+		{
+			name:   "redacted",
+			redact: "true",
+			want: []string{
+				"/Library/Containers/com.lukilabs.lukiapp/#",
+				"spaces (2): #",
+				"RAW_MATCH=true",
+				"DEFAULT_FOLDER_ID=#",
+				"REDACT=true",
+			},
+			hidden: []string{"Data/Search", "1111", "2222", "folder-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "REDACT", tt.redact)
+
+			cfg, err := NewConfig(nil)
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+
+			summary := cfg.Export()
+			for _, want := range tt.want {
+				if !strings.Contains(summary, want) {
+					t.Errorf("Export() = %q, want it to contain %q", summary, want)
+				}
+			}
+			for _, hidden := range tt.hidden {
+				if strings.Contains(summary, hidden) {
+					t.Errorf("Export() = %q, leaks %q", summary, hidden)
+				}
+			}
+			if strings.Contains(summary, "MAX_SPACES") {
+				t.Errorf("Export() = %q, lists a setting not given", summary)
+			}
+		})
+	}
+}
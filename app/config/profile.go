@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Profile is a named bundle of settings, selected by the profile variable,
+// so that several keywords can run the workflow with different behavior.
+type Profile struct {
+	Scope  string // "all" or "primary" space, empty keeps the allSpaces variable
+	Type   string // "documents" or "blocks" only, empty finds both
+	Limit  int    // number of results, zero keeps RESULT_LIMIT
+	Layout string // "list", "group", "outline" or "merge", empty keeps the configured one
+	Daily  bool   // include daily notes
+}
+
+// builtinProfiles are the profiles available without PROFILES. A profile of
+// the same name in PROFILES replaces them.
+var builtinProfiles = map[string]string{
+	"titles":   "type:documents",
+	"blocks":   "type:blocks",
+	"all":      "scope:all",
+	"daily":    "type:documents,daily:1",
+	"outline":  "layout:outline",
+	"overview": "scope:all,layout:group,limit:20",
+}
+
+// Profile returns the profile of the given name, from PROFILES or else the
+// built-in ones.
+func (c *Config) Profile(name string) (Profile, error) {
+	spec, ok := c.Profiles[name]
+	if !ok {
+		spec, ok = builtinProfiles[name]
+	}
+	if !ok {
+		return Profile{}, fmt.Errorf("no profile named %q", name)
+	}
+
+	profile, err := parseProfile(spec)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return profile, nil
+}
+
+// parseProfile reads the settings of a profile, given as
+// "key:value,key:value".
+func parseProfile(spec string) (Profile, error) {
+	var profile Profile
+	for _, setting := range strings.Split(spec, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+
+		i := strings.Index(setting, ":")
+		if i < 0 {
+			return Profile{}, fmt.Errorf("setting %q is not key:value", setting)
+		}
+		key, value := strings.ToLower(setting[:i]), strings.ToLower(setting[i+1:])
+
+		switch key {
+		case "scope":
+			if value != "all" && value != "primary" {
+				return Profile{}, fmt.Errorf("scope must be all or primary, not %q", value)
+			}
+			profile.Scope = value
+		case "type":
+			if value != "documents" && value != "blocks" {
+				return Profile{}, fmt.Errorf("type must be documents or blocks, not %q", value)
+			}
+			profile.Type = value
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				return Profile{}, fmt.Errorf("limit must be a positive number, not %q", value)
+			}
+			profile.Limit = limit
+		case "layout":
+			switch value {
+			case "list", "group", "outline", "merge":
+			default:
+				return Profile{}, fmt.Errorf("layout must be list, group, outline or merge, not %q", value)
+			}
+			profile.Layout = value
+		case "daily":
+			daily, err := strconv.ParseBool(value)
+			if err != nil {
+				return Profile{}, fmt.Errorf("daily must be true or false, not %q", value)
+			}
+			profile.Daily = daily
+		default:
+			return Profile{}, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+
+	return profile, nil
+}
+
+// ApplyProfile overrides the settings the profile sets. The scope and daily
+// notes are variables rather than settings and are left to the caller.
+func (c *Config) ApplyProfile(profile Profile) {
+	switch profile.Type {
+	case "documents":
+		c.DocumentsOnly, c.BodyOnly = true, false
+	case "blocks":
+		c.DocumentsOnly, c.BodyOnly = false, true
+	}
+
+	if profile.Limit > 0 {
+		c.ResultLimit = profile.Limit
+		if c.FetchLimit < c.ResultLimit {
+			c.FetchLimit = c.ResultLimit
+		}
+	}
+
+	if profile.Layout != "" {
+		c.GroupByDocument = profile.Layout == "group"
+		c.Outline = profile.Layout == "outline"
+		c.MergeBlocks = profile.Layout == "merge"
+	}
+}
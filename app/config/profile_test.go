@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexes(t, dir, "s1")
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	setEnv(t, "PROFILES", "work=scope:primary,type:blocks,limit:5;titles=type:documents,limit:10;broken=limit:none")
+
+	cfg, err := NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    Profile
+		wantErr bool
+	}{
+		{name: "overview", want: Profile{Scope: "all", Layout: "group", Limit: 20}},
+		{name: "daily", want: Profile{Type: "documents", Daily: true}},
+		{name: "work", want: Profile{Scope: "primary", Type: "blocks", Limit: 5}},
+		{name: "titles", want: Profile{Type: "documents", Limit: 10}},
+		{name: "broken", wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := cfg.Profile(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Profile(%q) error = %v, want an error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Profile(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseProfileInvalid(t *testing.T) {
+	specs := []string{
+		"scope",
+		"scope:home",
+		"type:tasks",
+		"limit:0",
+		"layout:grid",
+		"daily:often",
+		"colour:blue",
+	}
+
+	for _, spec := range specs {
+		if _, err := parseProfile(spec); err == nil {
+			t.Errorf("parseProfile(%q) error = nil, want an error", spec)
+		}
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    Config
+	}{
+		{
+			name:    "empty keeps the settings",
+			profile: Profile{},
+			want:    Config{BodyOnly: true, ResultLimit: 40, FetchLimit: 200, MergeBlocks: true},
+		},
+		{
+			name:    "documents",
+			profile: Profile{Type: "documents"},
+			want:    Config{DocumentsOnly: true, ResultLimit: 40, FetchLimit: 200, MergeBlocks: true},
+		},
+		{
+			name:    "limit above the fetch limit",
+			profile: Profile{Limit: 500},
+			want:    Config{BodyOnly: true, ResultLimit: 500, FetchLimit: 500, MergeBlocks: true},
+		},
+		{
+			name:    "layout",
+			profile: Profile{Layout: "outline"},
+			want:    Config{BodyOnly: true, ResultLimit: 40, FetchLimit: 200, Outline: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{BodyOnly: true, ResultLimit: 40, FetchLimit: 200, MergeBlocks: true}
+			cfg.ApplyProfile(tt.profile)
+
+			got := []interface{}{cfg.BodyOnly, cfg.DocumentsOnly, cfg.ResultLimit, cfg.FetchLimit, cfg.GroupByDocument, cfg.Outline, cfg.MergeBlocks}
+			want := []interface{}{tt.want.BodyOnly, tt.want.DocumentsOnly, tt.want.ResultLimit, tt.want.FetchLimit, tt.want.GroupByDocument, tt.want.Outline, tt.want.MergeBlocks}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ApplyProfile(%+v) = %v, want %v", tt.profile, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+)
+
+// craftProcess is the process name of the Craft app.
+const craftProcess = "Craft"
+
+// runCommand runs the command, failing when it exits non-zero.
+func runCommand(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+// isCraftRunning reports whether a Craft process exists, as told by pgrep run
+// through run. pgrep exits non-zero when nothing matches.
+func isCraftRunning(run func(name string, args ...string) error) bool {
+	return run("pgrep", "-x", craftProcess) == nil
+}
+
+// craftLaunchNote returns the subtitle telling that Craft will be launched
+// for create actions, or "" when Craft runs or the check is off.
+func craftLaunchNote(check bool) string {
+	if !check || isCraftRunning(runCommand) {
+		return ""
+	}
+
+	log.Printf("Craft is not running, create actions will launch it")
+	return "Craft is not running and will be launched first"
+}
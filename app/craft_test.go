@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsCraftRunning(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "process found", want: true},
+		{name: "no process", err: errors.New("exit status 1"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var command []string
+			run := func(name string, args ...string) error {
+				command = append([]string{name}, args...)
+				return tt.err
+			}
+
+			if got := isCraftRunning(run); got != tt.want {
+				t.Errorf("isCraftRunning() = %t, want %t", got, tt.want)
+			}
+			if want := []string{"pgrep", "-x", craftProcess}; !reflect.DeepEqual(command, want) {
+				t.Errorf("ran %q, want %q", command, want)
+			}
+		})
+	}
+}
+
+// fakePgrep puts a pgrep on PATH that exits with the given status.
+func fakePgrep(t *testing.T, status string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\nexit " + status + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "pgrep"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCraftLaunchNote(t *testing.T) {
+	tests := []struct {
+		name   string
+		check  bool
+		status string
+		want   bool
+	}{
+		{name: "check off", check: false, status: "1", want: false},
+		{name: "Craft running", check: true, status: "0", want: false},
+		{name: "Craft not running", check: true, status: "1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePgrep(t, tt.status)
+
+			if note := craftLaunchNote(tt.check); (note != "") != tt.want {
+				t.Errorf("craftLaunchNote(%t) = %q, want a note %t", tt.check, note, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddCreateNewDocumentLaunchNote(t *testing.T) {
+	wf := newTestWorkflow(t)
+
+	addCreateNewDocument(wf, []string{"s1"}, "", []string{"plan"}, "", "Craft is not running and will be launched first")
+
+	if item := feedbackItems(t, wf)[0]; item.Subtitle != "Craft is not running and will be launched first" {
+		t.Errorf("subtitle = %q, want the launch note", item.Subtitle)
+	}
+}
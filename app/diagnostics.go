@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// diagnosticsArg is the query that lists diagnostics instead of searching.
+const diagnosticsArg = "--doctor"
+
+// addDiagnostics lists the details worth attaching to a bug report.
+func addDiagnostics(wf *aw.Workflow, cfg *config.Config) {
+	wf.NewItem("Version " + version).
+		Subtitle("Workflow build").
+		Copytext(version).
+		Valid(false)
+
+	wf.NewItem(cfg.IndexPathDir).
+		Subtitle("Search index directory").
+		Copytext(cfg.IndexPathDir).
+		Valid(false)
+
+	// The primary space is where documents are created by default
+	primarySpaceID := cfg.PrimarySpaceID()
+	for _, si := range cfg.SearchIndexes() {
+		title := fmt.Sprintf("Space %s", si.SpaceID)
+		if si.SpaceID == primarySpaceID {
+			title = "★ " + title + " (primary)"
+		}
+
+		wf.NewItem(title).
+			Subtitle(si.Path()).
+			Copytext(si.Path()).
+			Valid(false)
+	}
+
+	wf.NewItem(wf.CacheDir()).
+		Subtitle("Workflow cache directory").
+		Copytext(wf.CacheDir()).
+		Valid(false)
+}
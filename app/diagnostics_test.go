@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestAddDiagnosticsVersion(t *testing.T) {
+	old := version
+	version = "v1.2.3"
+	t.Cleanup(func() { version = old })
+
+	wf := newTestWorkflow(t)
+	addDiagnostics(wf, newTestConfig(t, nil, "s1"))
+
+	items := feedbackItems(t, wf)
+	if len(items) == 0 {
+		t.Fatal("addDiagnostics() added no items")
+	}
+	if items[0].Title != "Version v1.2.3" || items[0].Text.Copy != "v1.2.3" {
+		t.Errorf("first item = %q copying %q, want the version", items[0].Title, items[0].Text.Copy)
+	}
+}
+
+func TestAddDiagnosticsMarksPrimarySpace(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		want    string
+	}{
+		{name: "detected", want: "s1"},
+		{name: "configured", primary: "s2", want: "s2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := newTestWorkflow(t)
+			addDiagnostics(wf, newTestConfig(t, map[string]string{"PRIMARY_SPACE": tt.primary}, "s1", "s1||s2"))
+
+			marked := map[string]bool{}
+			for _, item := range feedbackItems(t, wf) {
+				switch item.Title {
+				case "★ Space s1 (primary)":
+					marked["s1"] = true
+				case "★ Space s2 (primary)":
+					marked["s2"] = true
+				}
+			}
+			if len(marked) != 1 || !marked[tt.want] {
+				t.Errorf("marked spaces %v, want only %s", marked, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+)
+
+// exportConfigArg is the query that shows the configuration summary for a
+// bug report instead of searching.
+const exportConfigArg = "--export-config"
+
+// addExportConfig shows the configuration summary, ready to be copied.
+func addExportConfig(wf *aw.Workflow, cfg *config.Config) {
+	summary := "Version " + version + "\n" + cfg.Export()
+
+	subtitle := "⌘C copies it, ⌘L shows it"
+	if cfg.Redact {
+		subtitle += ", paths and IDs are redacted"
+	}
+
+	wf.NewItem("Configuration summary").
+		Subtitle(subtitle).
+		Copytext(summary).
+		Largetype(summary).
+		Valid(false)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+// resultRenderer turns search results into Alfred items.
+type resultRenderer struct {
+	wf           *aw.Workflow
+	cfg          *config.Config
+	blockService *service.BlockService
+	opts         repository.SearchOptions
+}
+
+// openURL returns the URL that opens the block in Craft. Craft opens a block
+// within its document, scrolled to it, so a block ID alone is enough and no
+// separate document link is needed. `open` succeeds even when Craft cannot
+// find the block, so there is no failure to fall back on. With
+// LINK_TARGET=web the web link template is used; the desktop app is the
+// fallback.
+func (r resultRenderer) openURL(blockID, documentID, spaceID string) string {
+	urlSpaceID := openSpaceID(r.cfg, r.opts.AllSpaces, r.opts.CurrentSpaceID, spaceID)
+
+	if r.cfg.LinkTarget == "web" {
+		if r.cfg.WebLinkTemplate != "" {
+			return strings.NewReplacer(
+				"{spaceId}", url.PathEscape(urlSpaceID),
+				"{documentId}", url.PathEscape(documentID),
+				"{blockId}", url.PathEscape(blockID),
+			).Replace(r.cfg.WebLinkTemplate)
+		}
+		log.Printf("LINK_TARGET=web needs WEB_LINK_TEMPLATE, opening in the desktop app")
+	}
+
+	link := "craftdocs://open?blockId=" + blockID + "&spaceId=" + urlSpaceID
+
+	// Documents open at the top, only blocks are worth highlighting
+	if r.cfg.HighlightBlock && blockID != documentID {
+		link += "&highlight=true"
+	}
+
+	return link
+}
+
+// Modifier keys wired to actions in info.plist. Alfred runs those actions for
+// every item, passing the item's own arg when the item does not set the
+// modifier, so every valid item either sets them or marks them invalid.
+var (
+	largeTypeMod   = []aw.ModKey{aw.ModCmd}
+	openAndCopyMod = []aw.ModKey{aw.ModCmd, aw.ModOpt}
+	listBlocksMod  = []aw.ModKey{aw.ModCtrl}
+)
+
+// addOpenModifiers sets the Large Type and the open and copy actions.
+func addOpenModifiers(item *aw.Item, text, link string) {
+	// ⌘↩ shows the full text in Large Type. The text travels in a variable
+	// so that multi-line text reaches Large Type unchanged.
+	item.NewModifier(largeTypeMod...).
+		Subtitle("Show in Large Type").
+		Arg(text).
+		Var("largeTypeText", text).
+		Valid(true)
+
+	// ⌘⌥↩ opens the result and copies its link. Both travel as variables
+	// so the downstream script can do each without parsing the arg.
+	item.NewModifier(openAndCopyMod...).
+		Subtitle("Open and copy link").
+		Arg(link).
+		Var("openURL", link).
+		Var("copyText", link).
+		Valid(true)
+}
+
+// disableModifiers marks the modifier actions the item has no use for
+// invalid.
+func disableModifiers(item *aw.Item, mods ...[]aw.ModKey) {
+	for _, keys := range mods {
+		item.NewModifier(keys...).Valid(false)
+	}
+}
+
+// lineBreaks flattens multi-line content into a single title line.
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// addBlock adds the item for a single search result.
+func (r resultRenderer) addBlock(ctx context.Context, block repository.Block) *aw.Item {
+	largeType := block.Content
+	if r.cfg.ContextWindow > 0 && !block.IsDocument() {
+		if text, err := r.blockService.BlockContext(ctx, block, r.cfg.ContextWindow); err != nil {
+			log.Printf("Fetching context of block %s failed: %v", block.ID, err)
+		} else {
+			largeType = text
+		}
+	}
+
+	subtitle := block.DocumentName
+	if block.Attachment != "" {
+		subtitle = "📎 " + block.Attachment + " · " + subtitle
+	}
+	if block.HeadingContext != "" {
+		subtitle += " › " + block.HeadingContext
+	}
+	if r.opts.FolderID != "" {
+		subtitle += " · in folder " + r.opts.FolderID
+	}
+	if r.opts.StarredOnly {
+		subtitle = "★ " + subtitle
+	}
+	subtitle = truncateSubtitle(subtitle, r.cfg.MaxSubtitleLen)
+
+	link := r.openURL(block.ID, block.DocumentID, block.SpaceID)
+
+	// Create Alfred item with Large Text support
+	item := r.wf.
+		NewItem(r.blockTitle(block)).
+		Subtitle(subtitle).
+		UID(itemUID(block)).
+		Arg(link).
+		Largetype(largeType).
+		Valid(true)
+
+	// The full content, line breaks and all, for Quick Look
+	if preview, err := writePreview(filepath.Join(r.wf.CacheDir(), previewDir), itemUID(block), block.Content); err != nil {
+		log.Printf("Writing the preview of block %s failed: %v", block.ID, err)
+	} else {
+		item.Quicklook(preview)
+	}
+
+	// Tab on a document narrows the search to its blocks
+	if block.IsDocument() {
+		item.Autocomplete("doc:" + block.DocumentID + " ")
+	}
+
+	if icon := r.cfg.SpaceIcon(block.SpaceID); icon != "" {
+		item.Icon(&aw.Icon{Value: icon})
+	}
+
+	addOpenModifiers(item, block.Content, link)
+	disableModifiers(item, listBlocksMod)
+
+	// Holding ⌥ shows why the result matched.
+	explanation := explainMatch(block, block.SpaceID)
+	item.Alt().
+		Subtitle(explanation).
+		Arg(explanation).
+		Valid(false)
+
+	return item
+}
+
+// blockTitle returns the single-line title of a search result.
+func (r resultRenderer) blockTitle(block repository.Block) string {
+	// Documents look like in Craft's sidebar, with their icon
+	title := block.Content
+	if block.IsDocument() && block.DocumentIcon != "" {
+		title = block.DocumentIcon + " " + title
+	} else if block.ReferenceID != "" {
+		// Resolved references show the title of the document they link
+		title = "↗ " + title
+	} else if !block.IsDocument() {
+		title = snippet(title, block.Match.MatchedWords, r.cfg.Snippet)
+	}
+
+	return lineBreaks.Replace(title)
+}
+
+// addOutline lists every document as a header followed by its matching
+// blocks. A document that matched itself serves as its own header.
+func (r resultRenderer) addOutline(ctx context.Context, groups []service.DocumentGroup) {
+	for _, group := range groups {
+		header := -1
+		for i, block := range group.Blocks {
+			if block.IsDocument() {
+				header = i
+				break
+			}
+		}
+
+		var blocks []repository.Block
+		if header != -1 {
+			r.addBlock(ctx, group.Blocks[header])
+			blocks = append(blocks, group.Blocks[:header]...)
+			blocks = append(blocks, group.Blocks[header+1:]...)
+		} else {
+			blocks = group.Blocks
+			link := r.openURL(group.DocumentID, group.DocumentID, group.SpaceID)
+			item := r.wf.
+				NewItem(group.Title).
+				Subtitle("[Document]").
+				UID(group.SpaceID + ":" + group.DocumentID).
+				Arg(link).
+				Valid(true)
+			addOpenModifiers(item, group.Title, link)
+			disableModifiers(item, listBlocksMod)
+		}
+
+		for _, block := range blocks {
+			r.addBlock(ctx, block).Title("↳ " + r.blockTitle(block))
+		}
+	}
+}
+
+// addDocumentGroup adds one item for a document and its matching blocks.
+// Autocompleting the item, or ⌃↩, lists the matching blocks via a `doc:`
+// token.
+func (r resultRenderer) addDocumentGroup(group service.DocumentGroup, terms []string) {
+	subtitle := "(1 match)"
+	if len(group.Blocks) != 1 {
+		subtitle = fmt.Sprintf("(%d matches)", len(group.Blocks))
+	}
+
+	title := group.Title
+	if icon := group.Blocks[0].DocumentIcon; icon != "" {
+		title = icon + " " + title
+	}
+
+	link := r.openURL(group.DocumentID, group.DocumentID, group.SpaceID)
+	scope := docScopeQuery(group.DocumentID, terms)
+	item := r.wf.
+		NewItem(title).
+		Subtitle(subtitle).
+		UID(group.SpaceID + ":" + group.DocumentID).
+		Arg(link).
+		Autocomplete(scope).
+		Valid(true)
+
+	addOpenModifiers(item, group.Title, link)
+	item.NewModifier(listBlocksMod...).
+		Subtitle(fmt.Sprintf("List all %d matching blocks", len(group.Blocks))).
+		Arg(scope).
+		Valid(true)
+}
+
+// addMergedGroup adds one item for a document with several matching blocks,
+// showing the top block. ⌃↩ searches again within the document to list all of
+// its matching blocks.
+func (r resultRenderer) addMergedGroup(ctx context.Context, group service.DocumentGroup, terms []string) {
+	top := group.Blocks[0]
+	scope := docScopeQuery(group.DocumentID, terms)
+
+	title := group.Title
+	if title == "" {
+		title = top.DocumentName
+	}
+
+	r.addBlock(ctx, top).
+		Title(title).
+		Subtitle(truncateSubtitle(fmt.Sprintf("%s · %d matches", top.Content, len(group.Blocks)), r.cfg.MaxSubtitleLen)).
+		Autocomplete(scope).
+		NewModifier(listBlocksMod...).
+		Subtitle(fmt.Sprintf("List all %d matching blocks", len(group.Blocks))).
+		Arg(scope).
+		Valid(true)
+}
+
+// docScopeQuery returns the query that searches for the terms within the
+// document.
+func docScopeQuery(documentID string, terms []string) string {
+	return strings.TrimSpace("doc:" + documentID + " " + strings.Join(terms, " "))
+}
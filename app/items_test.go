@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+func TestAddDocumentGroup(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+	group := service.DocumentGroup{
+		SpaceID:    "s1",
+		DocumentID: "doc1",
+		Title:      "Plan",
+		MatchCount: 5,
+		Blocks:     make([]repository.Block, 5),
+	}
+
+	r.addDocumentGroup(group, []string{"road", "map"})
+
+	items := feedbackItems(t, r.wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	item := items[0]
+	if item.Subtitle != "(5 matches)" {
+		t.Errorf("subtitle = %q, want the match count", item.Subtitle)
+	}
+
+	const scope = "doc:doc1 road map"
+	if item.Autocomplete != scope {
+		t.Errorf("autocomplete = %q, want %q", item.Autocomplete, scope)
+	}
+	expand, ok := item.modifier(aw.ModCtrl)
+	if !ok || !expand.Valid || expand.Arg != scope {
+		t.Errorf("⌃ modifier = %+v, want it to search %q", expand, scope)
+	}
+	for _, keys := range [][]aw.ModKey{largeTypeMod, openAndCopyMod} {
+		if mod, ok := item.modifier(keys...); !ok || !mod.Valid {
+			t.Errorf("modifier %v = %+v, want it set", keys, mod)
+		}
+	}
+}
+
+func TestAddMergedGroup(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+	groups := service.GroupByDocument([]repository.Block{
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "road map", DocumentTitle: "Plan", DocumentName: "Plan"},
+		{ID: "b2", DocumentID: "doc2", SpaceID: "s1", Content: "road trip", DocumentTitle: "Travel", DocumentName: "Travel"},
+		{ID: "b3", DocumentID: "doc1", SpaceID: "s1", Content: "map legend", DocumentTitle: "Plan", DocumentName: "Plan"},
+	})
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+
+	r.addMergedGroup(context.Background(), groups[0], []string{"road", "map"})
+
+	items := feedbackItems(t, r.wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want the blocks of the document collapsed into 1", len(items))
+	}
+	item := items[0]
+	if item.Title != "Plan" {
+		t.Errorf("title = %q, want the document title", item.Title)
+	}
+	if item.Subtitle != "road map · 2 matches" {
+		t.Errorf("subtitle = %q, want the top block and the match count", item.Subtitle)
+	}
+	if item.Arg != "craftdocs://open?blockId=b1&spaceId=s1" {
+		t.Errorf("arg = %q, want it to open the top block", item.Arg)
+	}
+
+	const scope = "doc:doc1 road map"
+	if item.Autocomplete != scope {
+		t.Errorf("autocomplete = %q, want %q", item.Autocomplete, scope)
+	}
+	expand, ok := item.modifier(listBlocksMod...)
+	if !ok || !expand.Valid || expand.Arg != scope {
+		t.Errorf("⌃ modifier = %+v, want it to search %q", expand, scope)
+	}
+}
+
+func TestAddDocumentGroupSingleMatch(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addDocumentGroup(service.DocumentGroup{SpaceID: "s1", DocumentID: "doc1", Title: "Plan", MatchCount: 1, Blocks: make([]repository.Block, 1)}, []string{"road"})
+
+	if got := feedbackItems(t, r.wf)[0].Subtitle; got != "(1 match)" {
+		t.Errorf("subtitle = %q, want %q", got, "(1 match)")
+	}
+}
+
+func TestAddBlockStarredSubtitle(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1", StarredOnly: true})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "plan details", DocumentName: "Plan A"})
+
+	if got := feedbackItems(t, r.wf)[0].Subtitle; got != "★ Plan A" {
+		t.Errorf("subtitle = %q, want the star glyph", got)
+	}
+}
+
+func TestAddOutline(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+	blocks := []repository.Block{
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "road map", DocumentTitle: "Plan"},
+		{ID: "b2", DocumentID: "doc2", SpaceID: "s1", Content: "road trip", DocumentTitle: "Travel"},
+		{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan", DocumentTitle: "Plan"},
+		{ID: "b3", DocumentID: "doc1", SpaceID: "s1", Content: "road\nworks", DocumentTitle: "Plan"},
+	}
+
+	r.addOutline(context.Background(), service.GroupByDocument(blocks))
+
+	items := feedbackItems(t, r.wf)
+	want := []string{"Plan", "↳ road map", "↳ road works", "Travel", "↳ road trip"}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i, title := range want {
+		if items[i].Title != title {
+			t.Errorf("item %d = %q, want %q", i, items[i].Title, title)
+		}
+	}
+
+	// The matched document is its own header, the other one is made up
+	if items[0].UID != "s1:doc1" {
+		t.Errorf("header UID = %q, want the document result", items[0].UID)
+	}
+	header := items[3]
+	if header.Subtitle != "[Document]" || header.Arg != "craftdocs://open?blockId=doc2&spaceId=s1" {
+		t.Errorf("made up header = %+v, want it to open the document", header)
+	}
+	for _, keys := range [][]aw.ModKey{largeTypeMod, openAndCopyMod} {
+		if mod, ok := header.modifier(keys...); !ok || !mod.Valid {
+			t.Errorf("header modifier %v = %+v, want it set", keys, mod)
+		}
+	}
+	if mod, ok := header.modifier(listBlocksMod...); !ok || mod.Valid {
+		t.Errorf("header modifier %v = %+v, want it disabled", listBlocksMod, mod)
+	}
+}
+
+func TestAddBlockLargeTypeModifier(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+	content := "first line\n\n**second** line\twith a tab"
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: content})
+
+	item := feedbackItems(t, r.wf)[0]
+	mod, ok := item.modifier(largeTypeMod...)
+	if !ok || !mod.Valid {
+		t.Fatalf("Large Type modifier = %+v, want it set", mod)
+	}
+	if mod.Arg != content || mod.Variables["largeTypeText"] != content {
+		t.Errorf("Large Type modifier carries %q / %q, want the full content %q", mod.Arg, mod.Variables["largeTypeText"], content)
+	}
+	if item.Text.LargeType != content {
+		t.Errorf("largetype = %q, want the full content", item.Text.LargeType)
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	const template = "https://docs.craft.do/s/{spaceId}/d/{documentId}?blockId={blockId}"
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{name: "desktop", want: "craftdocs://open?blockId=b1&spaceId=s1"},
+		{name: "web", vars: map[string]string{"LINK_TARGET": "web", "WEB_LINK_TEMPLATE": template}, want: "https://docs.craft.do/s/s1/d/doc%201?blockId=b1"},
+		{name: "web without template", vars: map[string]string{"LINK_TARGET": "web"}, want: "craftdocs://open?blockId=b1&spaceId=s1"},
+		{name: "highlight", vars: map[string]string{"HIGHLIGHT_BLOCK": "1"}, want: "craftdocs://open?blockId=b1&spaceId=s1&highlight=true"},
+		{name: "highlight on the web", vars: map[string]string{"HIGHLIGHT_BLOCK": "1", "LINK_TARGET": "web", "WEB_LINK_TEMPLATE": template}, want: "https://docs.craft.do/s/s1/d/doc%201?blockId=b1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRenderer(t, newTestConfig(t, tt.vars, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+			if got := r.openURL("b1", "doc 1", "s1"); got != tt.want {
+				t.Errorf("openURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddBlockOpensBlockInDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		opts repository.SearchOptions
+		want string
+	}{
+		{name: "primary space", opts: repository.SearchOptions{CurrentSpaceID: "s1"}, want: "craftdocs://open?blockId=b1&spaceId=s1"},
+		{name: "all spaces", opts: repository.SearchOptions{AllSpaces: true}, want: "craftdocs://open?blockId=b1&spaceId=s2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRenderer(t, newTestConfig(t, nil, "s1", "s2"), tt.opts)
+
+			r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s2", Content: "step"})
+
+			// Craft opens a block within its document, so the block ID is
+			// the whole link and the document needs none of its own
+			item := feedbackItems(t, r.wf)[0]
+			if item.Arg != tt.want {
+				t.Errorf("arg = %q, want %q", item.Arg, tt.want)
+			}
+			if strings.Contains(item.Arg, "doc1") {
+				t.Errorf("arg = %q, want no document link", item.Arg)
+			}
+		})
+	}
+}
+
+func TestOpenURLHighlightDocument(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, map[string]string{"HIGHLIGHT_BLOCK": "1"}, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	// Documents open at the top, there is nothing to highlight
+	want := "craftdocs://open?blockId=doc1&spaceId=s1"
+	if got := r.openURL("doc1", "doc1", "s1"); got != want {
+		t.Errorf("openURL() = %q, want %q", got, want)
+	}
+}
+
+func TestAddBlockDocumentAutocomplete(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan"})
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "step"})
+
+	items := feedbackItems(t, r.wf)
+	if items[0].Autocomplete != "doc:doc1 " {
+		t.Errorf("document autocomplete = %q, want %q", items[0].Autocomplete, "doc:doc1 ")
+	}
+	if items[0].Arg != "craftdocs://open?blockId=doc1&spaceId=s1" {
+		t.Errorf("document arg = %q, want it to open the document", items[0].Arg)
+	}
+	if items[1].Autocomplete != "" {
+		t.Errorf("block autocomplete = %q, want none", items[1].Autocomplete)
+	}
+}
+
+func TestAddBlockOpenAndCopyModifier(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "step"})
+
+	const link = "craftdocs://open?blockId=b1&spaceId=s1"
+	mod, ok := feedbackItems(t, r.wf)[0].modifier(openAndCopyMod...)
+	if !ok || !mod.Valid {
+		t.Fatalf("open and copy modifier = %+v, want it set", mod)
+	}
+	if mod.Arg != link || mod.Variables["openURL"] != link || mod.Variables["copyText"] != link {
+		t.Errorf("open and copy modifier = %+v, want %q to open and copy", mod, link)
+	}
+}
+
+func TestAddBlockMaxSubtitleLen(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, map[string]string{"MAX_SUBTITLE_LEN": "8"}, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "step", DocumentName: "Quarterly planning"})
+
+	if got := feedbackItems(t, r.wf)[0].Subtitle; got != "Quarter…" {
+		t.Errorf("subtitle = %q, want it cut to 8 runes", got)
+	}
+}
+
+func TestBlockTitleDocumentIcon(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	tests := []struct {
+		name  string
+		block repository.Block
+		want  string
+	}{
+		{name: "document with icon", block: repository.Block{ID: "doc1", DocumentID: "doc1", EntityType: "document", Content: "Plan", DocumentIcon: "🗺️"}, want: "🗺️ Plan"},
+		{name: "document without icon", block: repository.Block{ID: "doc1", DocumentID: "doc1", EntityType: "document", Content: "Plan"}, want: "Plan"},
+		{name: "block of a document with icon", block: repository.Block{ID: "b1", DocumentID: "doc1", Content: "road map", DocumentIcon: "🗺️"}, want: "road map"},
+	}
+
+	for _, tt := range tests {
+		if got := r.blockTitle(tt.block); got != tt.want {
+			t.Errorf("%s: blockTitle() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddBlockHeadingContext(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "the road is long", DocumentName: "Plan", HeadingContext: "Risks"})
+	r.addBlock(context.Background(), repository.Block{ID: "b2", DocumentID: "doc1", SpaceID: "s1", Content: "before any heading", DocumentName: "Plan"})
+
+	items := feedbackItems(t, r.wf)
+	if items[0].Subtitle != "Plan › Risks" {
+		t.Errorf("subtitle = %q, want the heading after the document", items[0].Subtitle)
+	}
+	if items[1].Subtitle != "Plan" {
+		t.Errorf("subtitle = %q, want the document alone", items[1].Subtitle)
+	}
+}
+
+func TestAddBlockFolderSubtitle(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1", FolderID: "f1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "plan details", DocumentName: "Plan"})
+
+	if item := feedbackItems(t, r.wf)[0]; item.Subtitle != "Plan · in folder f1" {
+		t.Errorf("subtitle = %q, want the folder after the document", item.Subtitle)
+	}
+}
+
+func TestAddBlockPreview(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+	content := "road map\r\n- first stop\n- second stop"
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: content})
+
+	item := feedbackItems(t, r.wf)[0]
+	if strings.ContainsAny(item.Title, "\r\n") {
+		t.Errorf("title = %q, want it on one line", item.Title)
+	}
+	if item.Quicklook == "" {
+		t.Fatal("Quicklook is not set")
+	}
+	data, err := os.ReadFile(item.Quicklook)
+	if err != nil {
+		t.Fatalf("reading the preview: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("preview = %q, want the full content %q", data, content)
+	}
+}
+
+func TestAddBlockAttachmentSubtitle(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{CurrentSpaceID: "s1"})
+
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "Q3 numbers", DocumentName: "Finance", Attachment: "report.pdf"})
+
+	if item := feedbackItems(t, r.wf)[0]; item.Subtitle != "📎 report.pdf · Finance" {
+		t.Errorf("subtitle = %q, want the file name before the document", item.Subtitle)
+	}
+}
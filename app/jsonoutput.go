@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+// jsonArg, given as the first argument, prints the results as JSON for
+// scripts instead of Alfred items.
+const jsonArg = "--json"
+
+type jsonScope struct {
+	AllSpaces  bool   `json:"allSpaces"`
+	SpaceID    string `json:"spaceId,omitempty"`
+	DocumentID string `json:"documentId,omitempty"`
+	Daily      bool   `json:"daily"`
+}
+
+type jsonCounts struct {
+	Results   int `json:"results"`
+	Documents int `json:"documents"`
+	Blocks    int `json:"blocks"`
+}
+
+type jsonResult struct {
+	ID            string `json:"id"`
+	Content       string `json:"content"`
+	EntityType    string `json:"entityType"`
+	SpaceID       string `json:"spaceId"`
+	DocumentID    string `json:"documentId"`
+	DocumentTitle string `json:"documentTitle"`
+	URL           string `json:"url"`
+}
+
+type jsonOutput struct {
+	Query   []string     `json:"query"`
+	Scope   jsonScope    `json:"scope"`
+	Counts  jsonCounts   `json:"counts"`
+	Results []jsonResult `json:"results"`
+}
+
+// writeJSON prints the results with everything a script needs to open them.
+func writeJSON(w io.Writer, renderer resultRenderer, query service.Query, blocks []repository.Block) error {
+	out := jsonOutput{
+		Query: query.Terms,
+		Scope: jsonScope{
+			AllSpaces:  renderer.opts.AllSpaces,
+			SpaceID:    renderer.opts.CurrentSpaceID,
+			DocumentID: renderer.opts.DocumentID,
+			Daily:      renderer.opts.Daily,
+		},
+		Results: make([]jsonResult, 0, len(blocks)),
+	}
+
+	for _, block := range blocks {
+		if block.IsDocument() {
+			out.Counts.Documents++
+		} else {
+			out.Counts.Blocks++
+		}
+
+		out.Results = append(out.Results, jsonResult{
+			ID:            block.ID,
+			Content:       block.Content,
+			EntityType:    block.EntityType,
+			SpaceID:       block.SpaceID,
+			DocumentID:    block.DocumentID,
+			DocumentTitle: block.DocumentTitle,
+			URL:           renderer.openURL(block.ID, block.DocumentID, block.SpaceID),
+		})
+	}
+	out.Counts.Results = len(out.Results)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+)
+
+func TestWriteJSON(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1", "s1||s2"), repository.SearchOptions{AllSpaces: true})
+	blocks := []repository.Block{
+		{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan", DocumentTitle: "Plan"},
+		{ID: "b1", DocumentID: "doc2", SpaceID: "s2", EntityType: "text", Content: "road map", DocumentTitle: "Trip"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, r, service.ParseQuery([]string{"road map"}), blocks); err != nil {
+		t.Fatalf("writeJSON() error = %v", err)
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	for _, field := range []string{"query", "scope", "counts", "results"} {
+		if _, ok := out[field]; !ok {
+			t.Errorf("the output has no %q", field)
+		}
+	}
+
+	counts, _ := out["counts"].(map[string]interface{})
+	if counts["results"] != 2.0 || counts["documents"] != 1.0 || counts["blocks"] != 1.0 {
+		t.Errorf("counts = %v, want 2 results, 1 document and 1 block", counts)
+	}
+	if scope, _ := out["scope"].(map[string]interface{}); scope["allSpaces"] != true {
+		t.Errorf("scope = %v, want all spaces", scope)
+	}
+
+	results, _ := out["results"].([]interface{})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	wantURLs := []string{"craftdocs://open?blockId=doc1&spaceId=s1", "craftdocs://open?blockId=b1&spaceId=s2"}
+	for i, result := range results {
+		fields, _ := result.(map[string]interface{})
+		for _, field := range []string{"id", "content", "entityType", "spaceId", "documentId", "documentTitle", "url"} {
+			if _, ok := fields[field]; !ok {
+				t.Errorf("result %d has no %q", i, field)
+			}
+		}
+		if fields["url"] != wantURLs[i] {
+			t.Errorf("result %d url = %v, want %s", i, fields["url"], wantURLs[i])
+		}
+	}
+}
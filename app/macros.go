@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+)
+
+// macroSigil leads a word naming a saved query of the MACROS config.
+const macroSigil = "@"
+
+// expandMacros replaces every `@name` word of the query with the saved query
+// of that name, keeping the other words around it. It also returns the names
+// with no saved query. A query without macros is returned unchanged.
+func expandMacros(args []string, macros map[string]string) ([]string, []string) {
+	query := strings.Join(args, " ")
+	if !strings.Contains(query, macroSigil) {
+		return args, nil
+	}
+
+	var (
+		words   []string
+		unknown []string
+	)
+	for _, word := range strings.Fields(query) {
+		name := strings.TrimPrefix(word, macroSigil)
+		if name == word || name == "" {
+			words = append(words, word)
+			continue
+		}
+
+		saved, ok := macros[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		words = append(words, saved)
+	}
+
+	return []string{strings.Join(words, " ")}, unknown
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandMacros(t *testing.T) {
+	macros := map[string]string{
+		"okr":  "folder:goals #okr",
+		"plan": "road map",
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantArgs    []string
+		wantUnknown []string
+	}{
+		{name: "no macro", args: []string{"road", "map"}, wantArgs: []string{"road", "map"}},
+		{name: "macro", args: []string{"@okr"}, wantArgs: []string{"folder:goals #okr"}},
+		{name: "with extra terms", args: []string{"@plan", "2024"}, wantArgs: []string{"road map 2024"}},
+		{name: "several macros", args: []string{"q3 @okr @plan"}, wantArgs: []string{"q3 folder:goals #okr road map"}},
+		{name: "unknown macro", args: []string{"@nope", "@plan"}, wantArgs: []string{"road map"}, wantUnknown: []string{"nope"}},
+		{name: "sigil alone", args: []string{"@", "road"}, wantArgs: []string{"@ road"}},
+		{name: "email", args: []string{"me@example.com"}, wantArgs: []string{"me@example.com"}},
+	}
+
+	for _, tt := range tests {
+		args, unknown := expandMacros(tt.args, macros)
+		if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(unknown, tt.wantUnknown) {
+			t.Errorf("%s: expandMacros(%q) = %q, %q, want %q, %q", tt.name, tt.args, args, unknown, tt.wantArgs, tt.wantUnknown)
+		}
+	}
+}
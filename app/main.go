@@ -3,34 +3,66 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/cache"
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-func initialize() (*config.Config, *service.BlockService, string, error) {
-	cfg, err := config.NewConfig()
+// sqliteDriver is the database/sql driver name go-sqlite3 registers.
+const sqliteDriver = "sqlite3"
+
+// checkDriver opens an in-memory database to make sure the sqlite driver
+// works. A build without cgo registers go-sqlite3's stub instead, which
+// fails every connection.
+func checkDriver() error {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Ping()
+}
+
+// requiresCgo reports whether err comes from go-sqlite3's stub, built with
+// CGO_ENABLED=0.
+func requiresCgo(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "requires cgo")
+}
+
+func initialize(indexCache config.IndexCache) (*config.Config, *service.BlockService, string, error) {
+	// A build without the sqlite driver would fail cryptically at query time
+	if err := checkDriver(); requiresCgo(err) {
+		return nil, nil, "", types.NewConfigError("sqlite driver not available", errors.New("this workflow build is incompatible with your Mac"))
+	} else if err != nil {
+		return nil, nil, "", types.NewError("sqlite driver not available", err)
+	}
+
+	cfg, err := config.NewConfig(indexCache)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("get config: %w", err)
 	}
 
 	var spaces []repository.Space
 	for _, si := range cfg.SearchIndexes() {
-		db, err := sql.Open("sqlite3", si.Path())
+		db, err := openIndex(cfg, si.Path())
 		if err != nil {
-			return nil, nil, "", fmt.Errorf("sql open: %w", err)
+			return nil, nil, "", types.NewError("Opening a search index failed", fmt.Errorf("sql open: %w", err))
 		}
 		spaces = append(spaces, repository.Space{
 			ID: si.SpaceID,
@@ -44,145 +76,771 @@ func initialize() (*config.Config, *service.BlockService, string, error) {
 	return cfg, blockService, "", nil
 }
 
-func flow(ctx context.Context, args []string, allSpaces bool, daily bool, currentSpaceID string) (*config.Config, []repository.Block, error) {
-	cfg, blockService, _, err := initialize()
+func flow(ctx context.Context, blockService *service.BlockService, args []string, opts repository.SearchOptions) ([]repository.Block, error) {
+	// Split search terms by whitespace to enable non-adjacent matching
+	searchTerms := args
+	if !opts.RawMatch {
+		searchTerms = nil
+		for _, arg := range args {
+			searchTerms = append(searchTerms, strings.Fields(arg)...)
+		}
+	}
+
+	blocks, err := blockService.Search(ctx, searchTerms, opts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("initialize: %w", err)
+		return nil, fmt.Errorf("search: %w", err)
 	}
 
-	defer func() { _ = blockService.Close() }()
+	return blocks, nil
+}
 
-	// Split search terms by whitespace to enable non-adjacent matching
-	var searchTerms []string
-	for _, arg := range args {
-		searchTerms = append(searchTerms, strings.Fields(arg)...)
+// addErrorItem shows err, telling failures worth retrying apart from the ones
+// that need the setup fixed.
+func addErrorItem(wf *aw.Workflow, fallbackTitle string, err error) {
+	var te types.Error
+	if !errors.As(err, &te) {
+		wf.NewWarningItem(fallbackTitle, err.Error())
+		return
 	}
 
-	blocks, err := blockService.Search(ctx, searchTerms, allSpaces, daily, currentSpaceID)
-	if err != nil {
-		return nil, nil, fmt.Errorf("search: %w", err)
+	switch te.Category {
+	case types.Transient:
+		wf.NewWarningItem(te.Title, "Try again: "+err.Error())
+	case types.Config:
+		wf.NewWarningItem(te.Title, "Fix your setup: "+err.Error())
+	default:
+		wf.NewWarningItem(te.Title, err.Error())
+	}
+}
+
+// addTimings shows how long each phase of the search took. Spaces are named
+// when SPACE_NAMES has a name for them.
+func addTimings(wf *aw.Workflow, cfg *config.Config, configLoad time.Duration, timings service.Timings) {
+	total := configLoad + timings.Scoring + timings.Backfill
+	parts := []string{"config " + formatDuration(configLoad)}
+	for _, space := range timings.Spaces {
+		total += space.Duration
+		name := cfg.SpaceName(space.SpaceID)
+		if name == "" {
+			name = space.SpaceID
+		}
+		parts = append(parts, name+" "+formatDuration(space.Duration))
 	}
+	parts = append(parts,
+		"scoring "+formatDuration(timings.Scoring),
+		"backfill "+formatDuration(timings.Backfill),
+	)
 
-	return cfg, blocks, nil
+	wf.
+		NewItem("Search took " + formatDuration(total)).
+		Subtitle(strings.Join(parts, ", ")).
+		Valid(false)
+}
+
+// formatDuration rounds the duration to a readable precision.
+func formatDuration(d time.Duration) string {
+	if d >= time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(10 * time.Microsecond).String()
 }
 
-func addCreateNewDocument(wf *aw.Workflow, config *config.Config, args []string) {
-	name := strings.Join(args, " ")
-	title := fmt.Sprintf("Create %q", name)
-	url := fmt.Sprintf("craftdocs://createdocument?spaceId=%s&title=%s&content=&folderId=", config.SearchIndexes()[0].SpaceID, url.PathEscape(name))
+// regexSearchMode is the value of the searchMode variable that searches for
+// the query as a regular expression. Only a literal prefix of the expression
+// narrows the blocks read from the index, so "road.*trip" is fast where
+// "(road|trip)" reads every block of the spaces searched.
+const regexSearchMode = "regex"
+
+// regexPattern returns the query as a regular expression in regex mode.
+func regexPattern(regexMode bool, terms []string) string {
+	if !regexMode || len(terms) == 0 {
+		return ""
+	}
+	return terms[0]
+}
+
+// symbolsOnly reports whether the terms hold no letter or digit at all.
+func symbolsOnly(terms []string) bool {
+	for _, term := range terms {
+		if strings.IndexFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			return false
+		}
+	}
+	return len(terms) > 0
+}
+
+// reverseBlocks reverses the order of the blocks in place.
+func reverseBlocks(blocks []repository.Block) {
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+}
+
+// itemUID makes the Alfred item UID unique across spaces, since block IDs of
+// different spaces may collide.
+func itemUID(block repository.Block) string {
+	return block.SpaceID + ":" + block.ID
+}
+
+// Scope sigils lead a query to search all spaces or the primary space only.
+const (
+	allSpacesSigil    = "*"
+	primarySpaceSigil = "!"
+)
+
+// cutScopeSigil removes a leading scope sigil from the query.
+func cutScopeSigil(args []string) (string, []string, bool) {
+	query := strings.TrimLeft(strings.Join(args, " "), " ")
+	for _, sigil := range []string{allSpacesSigil, primarySpaceSigil} {
+		if strings.HasPrefix(query, sigil) {
+			return sigil, []string{strings.TrimPrefix(query, sigil)}, true
+		}
+	}
+	return "", args, false
+}
+
+// surroundingQuotes maps the opening quote characters to their closing ones.
+var surroundingQuotes = map[rune]rune{'"': '"', '\'': '\'', '“': '”', '‘': '’'}
+
+// stripSurroundingQuotes removes one layer of quotes wrapping the whole query,
+// as Alfred may pass it quoted as a single argument. Quotes around a part of
+// the query, such as in `"foo" bar "baz"`, are kept.
+func stripSurroundingQuotes(args []string) []string {
+	query := []rune(strings.TrimSpace(strings.Join(args, " ")))
+	if len(query) < 2 {
+		return args
+	}
+
+	closing, ok := surroundingQuotes[query[0]]
+	if !ok || query[len(query)-1] != closing {
+		return args
+	}
+
+	inner := string(query[1 : len(query)-1])
+	if strings.ContainsRune(inner, query[0]) || strings.ContainsRune(inner, closing) {
+		return args
+	}
+
+	return []string{inner}
+}
+
+// Feedback size limits. Alfred struggles with multi-megabyte feedback, and
+// the content of a result appears in several fields of its item.
+const (
+	maxItemContentBytes   = 8 << 10
+	feedbackContentBudget = 256 << 10
+)
+
+// capContentSize truncates the content of every block to maxItem bytes and
+// drops the blocks beyond the budget for all contents. It reports whether
+// any block was dropped.
+func capContentSize(blocks []repository.Block, maxItem, budget int) ([]repository.Block, bool) {
+	capped := make([]repository.Block, 0, len(blocks))
+	total := 0
+	for _, block := range blocks {
+		block.Content = truncateBytes(block.Content, maxItem)
+		if total+len(block.Content) > budget {
+			return capped, true
+		}
+		total += len(block.Content)
+		capped = append(capped, block)
+	}
+	return capped, false
+}
+
+// truncateBytes shortens s to at most max bytes, cutting at a rune boundary
+// and ending it with an ellipsis.
+func truncateBytes(s string, max int) string {
+	const ellipsis = "…"
+	if len(s) <= max {
+		return s
+	}
+
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if cut < 0 {
+		cut = 0
+	}
+	return s[:cut] + ellipsis
+}
+
+// truncateSubtitle shortens s to at most max runes, ending it with an
+// ellipsis. A max of zero or less leaves s as is.
+func truncateSubtitle(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	runes := []rune(s)[:max-1]
+
+	return strings.TrimRightFunc(string(runes), unicode.IsSpace) + "…"
+}
+
+// explainMatch describes in plain words why a block is part of the results.
+func explainMatch(block repository.Block, spaceID string) string {
+	var reason string
+	switch m := block.Match; {
+	case m.EqualMatch:
+		reason = "Equals the query"
+	case m.ExactMatch:
+		reason = "Exact phrase match"
+	case m.OrderedWordsMatch:
+		reason = "All words match in order"
+	case m.AllWordsMatch:
+		reason = "All words match"
+	case m.Acronym:
+		reason = "Title initials match the query"
+	case m.Subsequence:
+		reason = "Title holds the query characters in order"
+	case m.JoinedMatch:
+		reason = "All words match across the document's blocks"
+	case len(m.MatchedWords) > 0:
+		reason = "Partial match"
+	default:
+		reason = "Recent document"
+	}
+
+	if block.Match.TagMatch {
+		reason = "Tagged; " + strings.ToLower(reason[:1]) + reason[1:]
+	}
+
+	if len(block.Match.MatchedWords) > 0 {
+		quoted := make([]string, 0, len(block.Match.MatchedWords))
+		for _, word := range block.Match.MatchedWords {
+			quoted = append(quoted, strconv.Quote(word))
+		}
+		reason += "; matched " + strings.Join(quoted, ", ") + " in content"
+	}
+
+	document := "itself a document"
+	if !block.IsDocument() {
+		document = "in document " + strconv.Quote(block.DocumentTitle)
+	}
+
+	return fmt.Sprintf("%s; %s; space %s", reason, document, spaceID)
+}
+
+// scopeSpaceID returns the space searched when not searching all spaces: the
+// primarySpace variable, or else the detected primary space.
+func scopeSpaceID(cfg *config.Config, allSpaces bool, primarySpace string) string {
+	if allSpaces {
+		log.Printf("Searching all spaces")
+		return ""
+	}
+
+	if primarySpace != "" {
+		log.Printf("Using configured primary space: %s", primarySpace)
+		return primarySpace
+	}
+
+	spaceID := cfg.PrimarySpaceID() // Fallback to the detected primary space
+	if spaceID != "" {
+		log.Printf("Using fallback primary space: %s", spaceID)
+	}
+	return spaceID
+}
+
+// resolveSpace finds the space a `space:` token refers to, by alias, exact ID
+// or, failing that, by case-insensitive ID prefix or name substring. A token
+// matching several spaces is ambiguous.
+func resolveSpace(cfg *config.Config, token string) (string, error) {
+	if spaceID := cfg.ResolveSpaceAlias(token); cfg.HasSpace(spaceID) {
+		return spaceID, nil
+	}
+
+	lowerToken := strings.ToLower(token)
+	var matches []string
+	for _, si := range cfg.SearchIndexes() {
+		name := strings.ToLower(cfg.SpaceName(si.SpaceID))
+		if name == lowerToken {
+			// A full name wins over names merely containing it
+			return si.SpaceID, nil
+		}
+		if strings.HasPrefix(strings.ToLower(si.SpaceID), lowerToken) || (name != "" && strings.Contains(name, lowerToken)) {
+			matches = append(matches, si.SpaceID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no space matches %q", token)
+	case 1:
+		return matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, spaceID := range matches {
+		if name := cfg.SpaceName(spaceID); name != "" {
+			names = append(names, name)
+			continue
+		}
+		names = append(names, spaceID)
+	}
+	return "", fmt.Errorf("%q matches %s", token, strings.Join(names, ", "))
+}
+
+// openSpaceID returns the space ID used in the open URL of a result.
+func openSpaceID(cfg *config.Config, allSpaces bool, currentSpaceID, blockSpaceID string) string {
+	if allSpaces {
+		// When searching all spaces, use the actual space where the block exists
+		return blockSpaceID
+	}
+
+	// When searching primary space only, use the primary space ID for all URLs
+	if currentSpaceID == "" {
+		return cfg.PrimarySpaceID() // Fallback
+	}
+	return currentSpaceID
+}
+
+// createSpaceIDs returns the spaces offered as targets for a new document.
+// Searching a single space creates in that space; searching all spaces uses
+// DEFAULT_CREATE_SPACE, or offers every space when it is unset.
+func createSpaceIDs(cfg *config.Config, allSpaces bool, currentSpaceID string) []string {
+	if !allSpaces && currentSpaceID != "" {
+		return []string{currentSpaceID}
+	}
+
+	if cfg.DefaultCreateSpace != "" {
+		if cfg.HasSpace(cfg.DefaultCreateSpace) {
+			return []string{cfg.DefaultCreateSpace}
+		}
+		log.Printf("Default create space %s not found, offering all spaces", cfg.DefaultCreateSpace)
+	}
+
+	var spaceIDs []string
+	seen := make(map[string]bool)
+	for _, si := range cfg.SearchIndexes() {
+		if !seen[si.SpaceID] {
+			spaceIDs = append(spaceIDs, si.SpaceID)
+			seen[si.SpaceID] = true
+		}
+	}
+	return spaceIDs
+}
+
+// addSearchAllSpaces offers to repeat the query in all spaces, by
+// autocompleting it with the all spaces sigil.
+func addSearchAllSpaces(wf *aw.Workflow, args []string) {
+	_, rest, _ := cutScopeSigil(args)
+	text := strings.TrimSpace(strings.Join(rest, " "))
+
 	wf.
-		NewItem(title).
-		UID(title).
-		Arg(url).
-		Valid(true)
+		NewItem(fmt.Sprintf("Search all spaces for %q", text)).
+		Subtitle("Nothing found in the primary space").
+		Autocomplete(allSpacesSigil + text).
+		Valid(false)
+}
+
+// createMode is the value of the mode variable for a keyword that only
+// creates documents.
+const createMode = "create"
+
+// addCreateNewDocument offers to create a document named after the query, with
+// the given content. An empty folderID creates it at the root of the space.
+func addCreateNewDocument(wf *aw.Workflow, spaceIDs []string, folderID string, args []string, content, launchNote string) {
+	// Never offer a document without a name, e.g. when listing recent ones
+	name := strings.TrimSpace(strings.Join(args, " "))
+	if name == "" {
+		return
+	}
+
+	for _, spaceID := range spaceIDs {
+		title := fmt.Sprintf("Create %q", name)
+		if len(spaceIDs) > 1 {
+			title = fmt.Sprintf("Create %q in %s", name, spaceID)
+		}
+		url := fmt.Sprintf("craftdocs://createdocument?spaceId=%s&title=%s&content=%s&folderId=%s", spaceID, url.PathEscape(name), url.QueryEscape(content), url.QueryEscape(folderID))
+		item := wf.
+			NewItem(title).
+			UID(title).
+			Arg(url).
+			Valid(true)
+		disableModifiers(item, largeTypeMod, openAndCopyMod, listBlocksMod)
+		if launchNote != "" {
+			item.Subtitle(launchNote)
+		}
+	}
 }
 
 func main() {
+	cache.EnsureWritableDir("alfred_workflow_cache")
+	cache.EnsureWritableDir("alfred_workflow_data")
+
 	wf := aw.New()
+	wfCache := cache.NewSoft(wf.Cache, wf.Debug())
+	log.Printf("CraftDocs search %s", version)
 
-	defer wf.SendFeedback()
+	// Args runs awgo's magic arguments, such as `workflow:delcache` or
+	// `workflow:log`, and exits, so they never reach the search.
+	args := wf.Args()
+
+	jsonOutput := len(args) > 0 && args[0] == jsonArg
+	if jsonOutput {
+		args = args[1:]
+	}
+
+	// Once the JSON results are written, there is no Alfred feedback to send
+	jsonWritten := false
+	// Work that can wait until Alfred has the results
+	var afterFeedback []func()
 	defer func() {
+		if jsonWritten {
+			return
+		}
 		if wf.IsEmpty() {
 			wf.NewItem("No results")
 		}
+		wf.SendFeedback()
+		for _, fn := range afterFeedback {
+			fn()
+		}
 	}()
 
-	// Read from Alfred's JSON input or environment variable
-	allSpacesStr := os.Getenv("allSpaces")
-	primarySpaceStr := os.Getenv("primarySpace")
-	dailyStr := os.Getenv("daily")
-	if allSpacesStr == "" || primarySpaceStr == "" || dailyStr == "" {
-		// Try to read from Alfred's stdin JSON (workflow variables)
-		if jsonBytes, err := io.ReadAll(os.Stdin); err == nil {
-			var alfredInput struct {
-				Variables map[string]string `json:"variables"`
-			}
-			if json.Unmarshal(jsonBytes, &alfredInput) == nil {
-				if allSpacesStr == "" {
-					allSpacesStr = alfredInput.Variables["allSpaces"]
-				}
-				if primarySpaceStr == "" {
-					primarySpaceStr = alfredInput.Variables["primarySpace"]
-				}
-				if dailyStr == "" {
-					dailyStr = alfredInput.Variables["daily"]
-				}
-			}
-		}
-	}
+	// Read the workflow variables from the environment or Alfred's JSON input
+	vars := readVariables(pipedStdin())
+	allSpacesStr := vars["allSpaces"]
+	primarySpaceStr := vars["primarySpace"]
+	dailyStr := vars["daily"]
+	currentDocumentID := vars["currentDocumentId"]
+	mode := vars["mode"]
+	createContent := vars["createContent"]
+	regexMode := vars["searchMode"] == regexSearchMode
 	allSpaces := allSpacesStr == "1"
 	daily := dailyStr == "1"
 	log.Printf("Search scope: allSpaces=%t (raw: '%s'), primarySpace='%s', daily=%t (raw: '%s')", allSpaces, allSpacesStr, primarySpaceStr, daily, dailyStr)
 
-	cfg, blockService, _, err := initialize()
+	if len(args) == 1 && args[0] == refreshArg {
+		refreshCaches(wf, wfCache)
+		return
+	}
+
+	initStart := time.Now()
+	cfg, blockService, _, err := initialize(wfCache)
+	configLoad := time.Since(initStart)
 	if err != nil {
 		log.Printf("Error initializing: %v", err)
-		wf.NewWarningItem("Initialization failed", err.Error())
+		addErrorItem(wf, "Initialization failed", err)
 		return
 	}
+	primarySpaceStr = cfg.ResolveSpaceAlias(primarySpaceStr)
 	defer func() { _ = blockService.Close() }()
 
-	var currentSpaceID string
-	if !allSpaces {
-		if primarySpaceStr != "" {
-			currentSpaceID = primarySpaceStr
-			log.Printf("Using configured primary space: %s", currentSpaceID)
-		} else if len(cfg.SearchIndexes()) > 0 {
-			currentSpaceID = cfg.SearchIndexes()[0].SpaceID // Fallback to first space
-			log.Printf("Using fallback primary space (first space): %s", currentSpaceID)
+	// A profile bundles the settings of a keyword, overriding the variables
+	if name := vars["profile"]; name != "" {
+		profile, err := cfg.Profile(name)
+		if err != nil {
+			wf.NewWarningItem("Unknown profile", err.Error())
+			return
 		}
-	} else {
-		log.Printf("Searching all spaces")
+		cfg.ApplyProfile(profile)
+		switch profile.Scope {
+		case "all":
+			allSpaces = true
+		case "primary":
+			allSpaces = false
+		}
+		daily = daily || profile.Daily
+		log.Printf("Profile %q: %+v", name, profile)
 	}
 
-	config, blocks, err := flow(context.Background(), os.Args[1:], allSpaces, daily, currentSpaceID)
-	if err != nil {
-		var te types.Error
-		if errors.As(err, &te) {
-			wf.NewWarningItem(te.Title, err.Error())
-		} else {
-			wf.NewWarningItem("Unknown error", err.Error())
-		}
+	if len(args) == 1 && args[0] == diagnosticsArg {
+		addDiagnostics(wf, cfg)
+		return
+	}
 
+	if len(args) == 1 && args[0] == exportConfigArg {
+		addExportConfig(wf, cfg)
 		return
 	}
 
+	args = stripSurroundingQuotes(args)
+
+	// Create URLs fired at a Craft that is not running may get lost
+	launchNote := craftLaunchNote(cfg.CheckCraftRunning)
+
+	// The create keyword never searches, the whole query names the document
+	if mode == createMode {
+		spaceIDs := createSpaceIDs(cfg, allSpaces, scopeSpaceID(cfg, allSpaces, primarySpaceStr))
+		addCreateNewDocument(wf, spaceIDs, cfg.DefaultFolderID, args, createContent, launchNote)
+		return
+	}
+
+	// The capture keyword appends the whole query to a document
+	if mode == captureMode {
+		opts := repository.SearchOptions{AllSpaces: allSpaces, CurrentSpaceID: scopeSpaceID(cfg, allSpaces, primarySpaceStr)}
+		if err := addCapture(context.Background(), wf, cfg, blockService, opts, args); err != nil {
+			addErrorItem(wf, "Capture failed", err)
+		}
+		return
+	}
+
+	// Saved queries expand before the tokens are parsed, raw queries are literal
+	if !cfg.RawMatch && !regexMode {
+		expanded, unknown := expandMacros(args, cfg.Macros)
+		if len(unknown) > 0 {
+			wf.NewWarningItem("Unknown macro", "MACROS has no "+macroSigil+strings.Join(unknown, ", "+macroSigil))
+			return
+		}
+		args = expanded
+	}
+
+	query := service.ParseQuery(args)
+	if cfg.RawMatch || regexMode {
+		query = service.RawQuery(args)
+	} else if sigil, rest, ok := cutScopeSigil(args); ok {
+		// A leading sigil overrides the allSpaces variable for this query
+		allSpaces = sigil == allSpacesSigil
+		query = service.ParseQuery(rest)
+		log.Printf("Scope sigil %q sets allSpaces=%t", sigil, allSpaces)
+	}
+	if spaceToken, ok := query.Tokens["space"]; ok {
+		spaceID, err := resolveSpace(cfg, spaceToken)
+		if err != nil {
+			wf.NewWarningItem("Unknown space", err.Error())
+			return
+		}
+		allSpaces = false
+		primarySpaceStr = spaceID
+		log.Printf("Space token %q scopes the search to %s", spaceToken, spaceID)
+	}
+
+	currentSpaceID := scopeSpaceID(cfg, allSpaces, primarySpaceStr)
+
+	// Symbols alone match markup everywhere, searched for as words they
+	// flood the results
+	rawMatch := cfg.RawMatch || regexMode
+	if !rawMatch && symbolsOnly(query.Terms) {
+		if !cfg.SymbolSearch {
+			wf.NewItem("Enter some text to search").
+				Subtitle("A query of symbols only matches markup everywhere").
+				Valid(false)
+			return
+		}
+		query.Terms = service.RawQuery(query.Terms).Terms
+		rawMatch = true
+	}
+
+	todo := strings.ToLower(query.Tokens["todo"])
+	if todo != "" && todo != repository.TodoOpen && todo != repository.TodoDone {
+		log.Printf("Unknown todo state %q, expected %s or %s", todo, repository.TodoOpen, repository.TodoDone)
+		todo = ""
+	}
+
+	opts := repository.SearchOptions{
+		AllSpaces:         allSpaces,
+		Daily:             daily,
+		CurrentSpaceID:    currentSpaceID,
+		PrimarySpaceID:    cfg.PrimarySpaceID(),
+		DocumentID:        query.Tokens["doc"],
+		SpaceTimeout:      time.Duration(cfg.PerSpaceTimeoutMS) * time.Millisecond,
+		StarredOnly:       cfg.StarredOnly || query.Flag("star"),
+		FolderID:          query.Tokens["folder"],
+		FolderPath:        query.Path,
+		File:              query.Tokens["file"],
+		RawMatch:          rawMatch,
+		FoldDiacritics:    cfg.FoldDiacritics,
+		Regex:             regexPattern(regexMode, query.Terms),
+		RecencyWeight:     cfg.RecencyWeight,
+		RecentBy:          cfg.RecentBy,
+		SortBy:            cfg.SortBy,
+		ModifiedColumn:    cfg.ModifiedColumn,
+		DocPriority:       cfg.DocPriority,
+		TitleWeight:       cfg.TitleWeight,
+		JoinedMatch:       cfg.JoinedMatch,
+		Subsequence:       cfg.Subsequence,
+		Acronym:           cfg.Acronym,
+		NumericBoundary:   cfg.NumericBoundary,
+		BodyOnly:          cfg.BodyOnly,
+		DocumentsOnly:     cfg.DocumentsOnly,
+		Todo:              todo,
+		WordPassThreshold: cfg.WordPassThreshold,
+		MaxWordPasses:     cfg.MaxWordPasses,
+		ResultLimit:       cfg.ResultLimit,
+		FetchLimit:        cfg.FetchLimit,
+		DisablePhrasePass: cfg.DisablePhrasePass,
+		DisableWordPass:   cfg.DisableWordPass,
+		MatchRatio:        cfg.MatchRatio,
+		EarlyMatch:        cfg.EarlyMatch,
+	}
+
+	// Retyping a query within QUERY_CACHE_TTL reuses its results
+	var blocks []repository.Block
+	var cached bool
+	var indexModTime time.Time
+	resultKey := queryResultKey(query.Terms, opts)
+	if cfg.QueryCacheTTL > 0 {
+		indexModTime = cfg.IndexModTime()
+		blocks, cached = loadQueryResults(wfCache, resultKey, indexModTime, cfg.QueryCacheTTL)
+	}
+
+	// Titles warmed by the previous query spare their lookups
+	if cfg.WarmCache {
+		if titles, ok := loadDocumentTitles(wfCache, cfg.IndexModTime()); ok {
+			blockService.UseDocumentTitles(titles)
+		}
+	}
+
+	dateRange, listDaily := query.Tokens["daily"]
+	switch {
+	case listDaily:
+		// A `daily:` token lists the daily notes of a date range instead
+		blocks, err = blockService.DailyNotes(context.Background(), dateRange, opts)
+		if err != nil {
+			addErrorItem(wf, "Listing daily notes failed", err)
+			return
+		}
+	case !cached:
+		blocks, err = flow(context.Background(), blockService, query.Terms, opts)
+		if err != nil {
+			addErrorItem(wf, "Unknown error", err)
+			return
+		}
+
+		// Results missing a timed out space are not worth repeating
+		if cfg.QueryCacheTTL > 0 && len(blockService.TimedOutSpaces()) == 0 {
+			storeQueryResults(wfCache, resultKey, indexModTime, cfg.QueryCacheTTL, blocks)
+		}
+	}
+
+	if !cfg.KeepTitleBlocks {
+		blocks = service.DropTitleDuplicates(blocks, cfg.FoldDiacritics)
+	}
+
+	if cfg.ShowHeading {
+		if err := blockService.BackfillHeadings(context.Background(), blocks); err != nil {
+			log.Printf("Resolving headings failed: %v", err)
+		}
+	}
+
+	if cfg.ClusterByDoc {
+		blocks = service.ClusterByDocument(blocks)
+	}
+
+	if currentDocumentID != "" {
+		log.Printf("Excluding current document %s", currentDocumentID)
+		blocks = service.ExcludeDocument(blocks, currentDocumentID, cfg.ExcludeCurrentDocumentBlocks)
+	}
+
+	// A `limit:` token caps the results of this query. Search never returns
+	// more than its own limit, so larger values change nothing.
+	if limitStr, ok := query.Tokens["limit"]; ok {
+		if limit, err := strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			log.Printf("Ignoring invalid limit %q", limitStr)
+		} else if limit < len(blocks) {
+			blocks = blocks[:limit]
+		}
+	}
+
+	// A `folder:` token scopes the search and overrides the configured
+	// default folder.
+	createFolderID := cfg.DefaultFolderID
+	if folderID, ok := query.Tokens["folder"]; ok {
+		createFolderID = folderID
+	}
+
+	// A token-only query browses its scope; there is no name to create.
+	var createSpaces []string
+	if !query.TokenOnly() {
+		createSpaces = createSpaceIDs(cfg, allSpaces, currentSpaceID)
+	}
 	if len(blocks) == 0 {
-		addCreateNewDocument(wf, config, os.Args[1:])
+		// A search scoped by the variable may find something elsewhere
+		_, hasSpaceToken := query.Tokens["space"]
+		if !allSpaces && !hasSpaceToken && !rawMatch && len(query.Terms) > 0 {
+			addSearchAllSpaces(wf, args)
+		}
+		if cfg.CreateOnNoResults {
+			addCreateNewDocument(wf, createSpaces, createFolderID, query.Terms, "", launchNote)
+		}
 	}
 
-	// Note: Blocks are now pre-sorted by fuzzy search scoring in block_repo.go
-	// Documents are automatically prioritized when match quality is equal
+	// Huge blocks would make the feedback too large for Alfred
+	blocks, sizeTruncated := capContentSize(blocks, maxItemContentBytes, feedbackContentBudget)
 
-	newDocumentEntryAdded := false
-	for _, block := range blocks {
-		// Append new document after documents but before
-		// individual blocks.
-		if !newDocumentEntryAdded && !block.IsDocument() {
-			addCreateNewDocument(wf, config, os.Args[1:])
-			newDocumentEntryAdded = true
-		}
-
-		// Use appropriate spaceId for URL generation
-		var urlSpaceID string
-		if allSpaces {
-			// When searching all spaces, use the actual space where the block exists
-			urlSpaceID = block.SpaceID
-		} else {
-			// When searching primary space only, use the primary space ID for all URLs
-			urlSpaceID = currentSpaceID
-			if urlSpaceID == "" && len(cfg.SearchIndexes()) > 0 {
-				urlSpaceID = cfg.SearchIndexes()[0].SpaceID // Fallback
+	// Blocks are rendered in the order Search ranked them, which already
+	// puts documents and then the primary space first at equal match quality
+	if cfg.Reverse {
+		reverseBlocks(blocks)
+	}
+
+	renderer := resultRenderer{wf: wf, cfg: cfg, blockService: blockService, opts: opts}
+
+	if jsonOutput {
+		if err := writeJSON(os.Stdout, renderer, query, blocks); err != nil {
+			addErrorItem(wf, "Writing JSON failed", err)
+			return
+		}
+		jsonWritten = true
+		return
+	}
+
+	switch {
+	case cfg.GroupByDocument && opts.DocumentID == "":
+		groups := service.RankGroups(service.GroupByDocument(blocks))
+		for _, group := range groups {
+			renderer.addDocumentGroup(group, query.Terms)
+		}
+		if len(groups) > 0 {
+			addCreateNewDocument(wf, createSpaces, createFolderID, query.Terms, "", launchNote)
+		}
+	case cfg.MergeBlocks && opts.DocumentID == "":
+		newDocumentEntryAdded := false
+		for _, group := range service.GroupByDocument(blocks) {
+			if !newDocumentEntryAdded && !group.Blocks[0].IsDocument() {
+				addCreateNewDocument(wf, createSpaces, createFolderID, query.Terms, "", launchNote)
+				newDocumentEntryAdded = true
 			}
+
+			if len(group.Blocks) == 1 {
+				renderer.addBlock(context.Background(), group.Blocks[0])
+				continue
+			}
+			renderer.addMergedGroup(context.Background(), group, query.Terms)
+		}
+	case cfg.Outline:
+		groups := service.GroupByDocument(blocks)
+		renderer.addOutline(context.Background(), groups)
+		if len(groups) > 0 {
+			addCreateNewDocument(wf, createSpaces, createFolderID, query.Terms, "", launchNote)
 		}
+	default:
+		newDocumentEntryAdded := false
+		for _, block := range blocks {
+			// Append new document after documents but before
+			// individual blocks.
+			if !newDocumentEntryAdded && !block.IsDocument() {
+				addCreateNewDocument(wf, createSpaces, createFolderID, query.Terms, "", launchNote)
+				newDocumentEntryAdded = true
+			}
 
-		// Create Alfred item with Large Text support
-		wf.
-			NewItem(block.Content).
-			Subtitle(block.DocumentName).
-			UID(block.ID).
-			Arg("craftdocs://open?blockId=" + block.ID + "&spaceId=" + urlSpaceID).
-			Largetype(block.Content).
-			Valid(true)
+			renderer.addBlock(context.Background(), block)
+		}
+	}
+
+	if sizeTruncated {
+		wf.NewWarningItem("Results truncated for size", "Refine the query to see the remaining results")
+	}
+
+	if timedOut := blockService.TimedOutSpaces(); len(timedOut) > 0 {
+		wf.NewWarningItem("Some spaces timed out", "Results are missing from "+strings.Join(timedOut, ", "))
+	}
+
+	if cfg.ShowTimings {
+		addTimings(wf, cfg, configLoad, blockService.Timings())
+	}
+
+	afterFeedback = append(afterFeedback, func() {
+		if err := prunePreviews(filepath.Join(wf.CacheDir(), previewDir), maxPreviews); err != nil {
+			log.Printf("Pruning the previews failed: %v", err)
+		}
+	})
+
+	if cfg.WarmCache {
+		afterFeedback = append(afterFeedback, func() {
+			warmDocumentTitles(wfCache, cfg.IndexModTime(), blocks)
+		})
 	}
 }
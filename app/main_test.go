@@ -0,0 +1,900 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/service"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// setEnv sets an environment variable for the duration of the test.
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, had := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// newTestConfig loads the configuration from vars, with an empty search
+// index file for each of the index names, such as "s1" or "s1||s2".
+func newTestConfig(t *testing.T, vars map[string]string, indexNames ...string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range indexNames {
+		if err := os.WriteFile(filepath.Join(dir, "SearchIndex_"+name+".sqlite"), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setEnv(t, "INDEX_PATH_DIR", dir)
+	for key, value := range vars {
+		setEnv(t, key, value)
+	}
+
+	cfg, err := config.NewConfig(nil)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	return cfg
+}
+
+// newTestWorkflow returns a workflow with its own cache and data dirs.
+func newTestWorkflow(t *testing.T) *aw.Workflow {
+	t.Helper()
+
+	return aw.NewFromEnv(aw.MapEnv{
+		"alfred_workflow_bundleid": "com.example.craftdocs.test",
+		"alfred_workflow_name":     "CraftDocs test",
+		"alfred_workflow_version":  "0.0.0",
+		"alfred_workflow_cache":    t.TempDir(),
+		"alfred_workflow_data":     t.TempDir(),
+	})
+}
+
+// testModifier is a modifier of an item as Alfred receives it.
+type testModifier struct {
+	Subtitle  string            `json:"subtitle"`
+	Arg       string            `json:"arg"`
+	Valid     bool              `json:"valid"`
+	Variables map[string]string `json:"variables"`
+}
+
+// testItem is an item as Alfred receives it.
+type testItem struct {
+	Title        string `json:"title"`
+	Subtitle     string `json:"subtitle"`
+	Autocomplete string `json:"autocomplete"`
+	Arg          string `json:"arg"`
+	UID          string `json:"uid"`
+	Valid        bool   `json:"valid"`
+	Text         struct {
+		Copy      string `json:"copy"`
+		LargeType string `json:"largetype"`
+	} `json:"text"`
+	Quicklook string                  `json:"quicklookurl"`
+	Variables map[string]string       `json:"variables"`
+	Mods      map[string]testModifier `json:"mods"`
+}
+
+// modifier returns the modifier of the keys, whatever order they are joined
+// in.
+func (it testItem) modifier(keys ...aw.ModKey) (testModifier, bool) {
+	want := make([]string, 0, len(keys))
+	for _, key := range keys {
+		want = append(want, string(key))
+	}
+	sort.Strings(want)
+
+	for combo, mod := range it.Mods {
+		got := strings.Split(combo, "+")
+		sort.Strings(got)
+		if reflect.DeepEqual(got, want) {
+			return mod, true
+		}
+	}
+	return testModifier{}, false
+}
+
+// feedbackItems returns the items of the workflow's feedback.
+func feedbackItems(t *testing.T, wf *aw.Workflow) []testItem {
+	t.Helper()
+
+	data, err := json.Marshal(wf.Feedback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feedback struct {
+		Items []testItem `json:"items"`
+	}
+	if err := json.Unmarshal(data, &feedback); err != nil {
+		t.Fatal(err)
+	}
+	return feedback.Items
+}
+
+// newTestRenderer returns a renderer writing to a new workflow.
+func newTestRenderer(t *testing.T, cfg *config.Config, opts repository.SearchOptions) resultRenderer {
+	t.Helper()
+
+	return resultRenderer{wf: newTestWorkflow(t), cfg: cfg, opts: opts}
+}
+
+func TestCreateSpaceIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		vars      map[string]string
+		allSpaces bool
+		current   string
+		want      []string
+	}{
+		{name: "single space", current: "s1", want: []string{"s1"}},
+		{name: "default create space", vars: map[string]string{"DEFAULT_CREATE_SPACE": "s2"}, allSpaces: true, want: []string{"s2"}},
+		{name: "default create space alias", vars: map[string]string{"DEFAULT_CREATE_SPACE": "work", "SPACE_ALIASES": "work:s2"}, allSpaces: true, want: []string{"s2"}},
+		{name: "unknown default offers every space", vars: map[string]string{"DEFAULT_CREATE_SPACE": "gone"}, allSpaces: true, want: []string{"s1", "s2"}},
+		{name: "unset offers every space", allSpaces: true, want: []string{"s1", "s2"}},
+		{name: "all spaces ignores the current space", allSpaces: true, current: "s1", want: []string{"s1", "s2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, tt.vars, "s1", "s1||s2")
+
+			if got := createSpaceIDs(cfg, tt.allSpaces, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("createSpaceIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		block repository.Block
+		want  string
+	}{
+		{
+			name:  "exact phrase in a block",
+			block: repository.Block{EntityType: "block", DocumentTitle: "Plan", Match: repository.Match{ExactMatch: true, OrderedWordsMatch: true, AllWordsMatch: true, MatchedWords: []string{"road", "map"}}},
+			want:  `Exact phrase match; matched "road", "map" in content; in document "Plan"; space s1`,
+		},
+		{
+			name:  "all words in a document",
+			block: repository.Block{EntityType: "document", Match: repository.Match{AllWordsMatch: true, MatchedWords: []string{"map"}}},
+			want:  `All words match; matched "map" in content; itself a document; space s1`,
+		},
+		{
+			name:  "tagged ordered words",
+			block: repository.Block{EntityType: "block", DocumentTitle: "Plan", Match: repository.Match{OrderedWordsMatch: true, TagMatch: true, MatchedWords: []string{"map"}}},
+			want:  `Tagged; all words match in order; matched "map" in content; in document "Plan"; space s1`,
+		},
+		{
+			name:  "partial",
+			block: repository.Block{EntityType: "block", DocumentTitle: "Plan", Match: repository.Match{MatchedWords: []string{"road"}}},
+			want:  `Partial match; matched "road" in content; in document "Plan"; space s1`,
+		},
+		{
+			name:  "recent document",
+			block: repository.Block{EntityType: "document"},
+			want:  "Recent document; itself a document; space s1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := explainMatch(tt.block, "s1"); got != tt.want {
+				t.Errorf("explainMatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddBlockExplanation(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1"), repository.SearchOptions{})
+	block := repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "road map", DocumentTitle: "Plan", Match: repository.Match{ExactMatch: true, MatchedWords: []string{"road"}}}
+
+	r.addBlock(context.Background(), block)
+
+	items := feedbackItems(t, r.wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	mod, ok := items[0].modifier(aw.ModOpt)
+	if !ok {
+		t.Fatal("the result has no ⌥ modifier")
+	}
+	if want := explainMatch(block, "s1"); mod.Subtitle != want || mod.Arg != want {
+		t.Errorf("⌥ modifier = %q / %q, want the explanation %q", mod.Subtitle, mod.Arg, want)
+	}
+	if mod.Valid {
+		t.Error("the explanation is actionable, want it shown only")
+	}
+}
+
+func TestItemUIDAcrossSpaces(t *testing.T) {
+	r := newTestRenderer(t, newTestConfig(t, nil, "s1", "s1||s2"), repository.SearchOptions{AllSpaces: true})
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "draft"})
+	r.addBlock(context.Background(), repository.Block{ID: "b1", DocumentID: "doc1", SpaceID: "s2", Content: "draft"})
+
+	items := feedbackItems(t, r.wf)
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].UID == items[1].UID {
+		t.Errorf("blocks of different spaces share the UID %q", items[0].UID)
+	}
+
+	// The open URL still addresses the block by its own ID
+	for i, spaceID := range []string{"s1", "s2"} {
+		if want := "craftdocs://open?blockId=b1&spaceId=" + spaceID; items[i].Arg != want {
+			t.Errorf("item %d arg = %q, want %q", i, items[i].Arg, want)
+		}
+	}
+}
+
+func TestAddCreateNewDocumentFolder(t *testing.T) {
+	tests := []struct {
+		name     string
+		folderID string
+		want     string
+	}{
+		{name: "root", folderID: "", want: "craftdocs://createdocument?spaceId=s1&title=road%20map&content=&folderId="},
+		{name: "folder", folderID: "f1", want: "craftdocs://createdocument?spaceId=s1&title=road%20map&content=&folderId=f1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := newTestWorkflow(t)
+			addCreateNewDocument(wf, []string{"s1"}, tt.folderID, []string{"road", "map"}, "", "")
+
+			items := feedbackItems(t, wf)
+			if len(items) != 1 {
+				t.Fatalf("got %d items, want 1", len(items))
+			}
+			if items[0].Arg != tt.want {
+				t.Errorf("create URL = %q, want %q", items[0].Arg, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddErrorItem(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		title    string
+		subtitle string
+	}{
+		{name: "transient", err: types.NewError("Search failed", errors.New("database is locked")), title: "Search failed", subtitle: "Try again: database is locked"},
+		{name: "config", err: fmt.Errorf("get config: %w", types.NewConfigError("No search indexes", errors.New("no index files found"))), title: "No search indexes", subtitle: "Fix your setup: get config: no index files found"},
+		{name: "fatal", err: types.NewError("Search failed", errors.New("malformed")), title: "Search failed", subtitle: "malformed"},
+		{name: "untyped", err: errors.New("boom"), title: "Fallback", subtitle: "boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := newTestWorkflow(t)
+			addErrorItem(wf, "Fallback", tt.err)
+
+			items := feedbackItems(t, wf)
+			if len(items) != 1 || items[0].Title != tt.title || items[0].Subtitle != tt.subtitle {
+				t.Errorf("items = %+v, want %q / %q", items, tt.title, tt.subtitle)
+			}
+		})
+	}
+}
+
+func TestAddCreateNewDocumentModifiers(t *testing.T) {
+	wf := newTestWorkflow(t)
+
+	addCreateNewDocument(wf, []string{"s1"}, "", []string{"plan"}, "", "")
+
+	items := feedbackItems(t, wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	for _, keys := range [][]aw.ModKey{largeTypeMod, openAndCopyMod, listBlocksMod} {
+		if mod, ok := items[0].modifier(keys...); !ok || mod.Valid {
+			t.Errorf("modifier %v = %+v, want it set and invalid", keys, mod)
+		}
+	}
+}
+
+func TestAddCreateNewDocumentWithoutName(t *testing.T) {
+	for _, args := range [][]string{nil, {""}, {"   "}, {"\t", " "}} {
+		wf := newTestWorkflow(t)
+		addCreateNewDocument(wf, []string{"s1"}, "", args, "", "")
+
+		if items := feedbackItems(t, wf); len(items) != 0 {
+			t.Errorf("addCreateNewDocument(%q) offered %+v, want nothing", args, items)
+		}
+	}
+}
+
+func TestAddCreateNewDocumentTrimsName(t *testing.T) {
+	wf := newTestWorkflow(t)
+	addCreateNewDocument(wf, []string{"s1"}, "", []string{" road map "}, "", "")
+
+	items := feedbackItems(t, wf)
+	if len(items) != 1 || items[0].Title != `Create "road map"` {
+		t.Errorf("items = %+v, want the trimmed name", items)
+	}
+}
+
+func TestMagicArgumentSkipsSearch(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == "1" {
+		os.Args = []string{"craftdocs", "workflow:delcache"}
+		main()
+		return
+	}
+
+	cacheDir := t.TempDir()
+	marker := filepath.Join(cacheDir, "marker")
+	if err := os.WriteFile(marker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMagicArgumentSkipsSearch$")
+	cmd.Env = append(os.Environ(),
+		"CRAFTDOCS_TEST_MAIN=1",
+		"alfred_workflow_bundleid=com.example.craftdocs.test",
+		"alfred_workflow_cache="+cacheDir,
+		"alfred_workflow_data="+t.TempDir(),
+		// Searching an empty directory fails, the magic argument must not
+		"INDEX_PATH_DIR="+t.TempDir(),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("main() failed: %v\n%s", err, out)
+	}
+
+	if strings.Contains(strings.ToLower(string(out)), "search indexes") {
+		t.Errorf("the magic argument reached the search:\n%s", out)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("workflow:delcache left the cache in place: %v", err)
+	}
+}
+
+func TestCreateModeSkipsSearch(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == t.Name() {
+		os.Args = []string{"craftdocs", "road", "map"}
+		main()
+		return
+	}
+
+	// An index without tables fails any search, create mode must not run one
+	indexDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(indexDir, "SearchIndex_s1.sqlite"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	items := runMain(t, t.Name(), "INDEX_PATH_DIR="+indexDir, "mode="+createMode)
+
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want only the create item: %+v", len(items), items)
+	}
+	if item := items[0]; item.Title != `Create "road map"` || !strings.HasPrefix(item.Arg, "craftdocs://createdocument?spaceId=s1&title=road%20map&") {
+		t.Errorf("item = %q with arg %q, want the create item for %q", item.Title, item.Arg, "road map")
+	}
+}
+
+func TestTruncateSubtitle(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"Projects › Plan", 0, "Projects › Plan"},
+		{"Projects › Plan", 15, "Projects › Plan"},
+		{"Projects › Plan", 11, "Projects ›…"},
+		{"Projects › Plan", 10, "Projects…"},
+		{"Проекты › План", 9, "Проекты…"},
+		{"📎 a.pdf · Plan", 4, "📎 a…"},
+	}
+
+	for _, tt := range tests {
+		got := truncateSubtitle(tt.s, tt.max)
+		if got != tt.want {
+			t.Errorf("truncateSubtitle(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateSubtitle(%q, %d) cut a rune", tt.s, tt.max)
+		}
+	}
+}
+
+func TestStripSurroundingQuotes(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{`"foo bar"`}, []string{"foo bar"}},
+		{[]string{`'foo'`}, []string{"foo"}},
+		{[]string{`"foo`, `bar"`}, []string{"foo bar"}},
+		{[]string{`“foo bar”`}, []string{"foo bar"}},
+		{[]string{`"foo" bar "baz"`}, []string{`"foo" bar "baz"`}},
+		{[]string{`"foo' `}, []string{`"foo' `}},
+		{[]string{"foo", "bar"}, []string{"foo", "bar"}},
+		{[]string{`"`}, []string{`"`}},
+	}
+
+	for _, tt := range tests {
+		if got := stripSurroundingQuotes(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("stripSurroundingQuotes(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCutScopeSigil(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantSigil string
+		wantRest  []string
+		wantOK    bool
+	}{
+		{[]string{"*road map"}, allSpacesSigil, []string{"road map"}, true},
+		{[]string{"!road", "map"}, primarySpaceSigil, []string{"road map"}, true},
+		{[]string{" *road"}, allSpacesSigil, []string{"road"}, true},
+		{[]string{"road", "map"}, "", []string{"road", "map"}, false},
+		{[]string{"road*"}, "", []string{"road*"}, false},
+	}
+
+	for _, tt := range tests {
+		sigil, rest, ok := cutScopeSigil(tt.args)
+		if sigil != tt.wantSigil || !reflect.DeepEqual(rest, tt.wantRest) || ok != tt.wantOK {
+			t.Errorf("cutScopeSigil(%q) = %q, %q, %t, want %q, %q, %t", tt.args, sigil, rest, ok, tt.wantSigil, tt.wantRest, tt.wantOK)
+		}
+	}
+}
+
+func TestResolveSpace(t *testing.T) {
+	cfg := newTestConfig(t, map[string]string{
+		"SPACE_NAMES":   "1111:Work,2222:Home,3333:Homestead",
+		"SPACE_ALIASES": "w:1111,old:4444",
+	}, "1111", "2222", "3333")
+
+	tests := []struct {
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{token: "w", want: "1111"},
+		{token: "2222", want: "2222"},
+		{token: "wo", want: "1111"},
+		{token: "WORK", want: "1111"},
+		{token: "33", want: "3333"},
+		{token: "home", want: "2222"},
+		{token: "hom", wantErr: true},
+		{token: "ome", wantErr: true},
+		{token: "garden", wantErr: true},
+		{token: "old", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveSpace(cfg, tt.token)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSpace(%q) = %q, %v, want %q, error %t", tt.token, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCapContentSize(t *testing.T) {
+	huge := strings.Repeat("é", 100)
+	blocks := []repository.Block{
+		{ID: "b1", Content: huge},
+		{ID: "b2", Content: "short"},
+		{ID: "b3", Content: huge},
+		{ID: "b4", Content: huge},
+	}
+
+	capped, truncated := capContentSize(blocks, 50, 100)
+
+	if !truncated {
+		t.Error("capContentSize() did not report dropping blocks over the budget")
+	}
+	if len(capped) != 2 || capped[0].ID != "b1" || capped[1].ID != "b2" {
+		t.Fatalf("capContentSize() kept %+v, want b1 and b2", capped)
+	}
+	total := 0
+	for _, block := range capped {
+		if len(block.Content) > 50 || !utf8.ValidString(block.Content) {
+			t.Errorf("content of %s = %q, want at most 50 bytes of valid UTF-8", block.ID, block.Content)
+		}
+		total += len(block.Content)
+	}
+	if total > 100 {
+		t.Errorf("kept %d bytes of content, want at most 100", total)
+	}
+	if blocks[0].Content != huge {
+		t.Error("capContentSize() changed the blocks passed in")
+	}
+}
+
+func TestCapContentSizeWithinBudget(t *testing.T) {
+	blocks := []repository.Block{{ID: "b1", Content: "road"}, {ID: "b2", Content: "map"}}
+
+	capped, truncated := capContentSize(blocks, 50, 110)
+
+	if truncated || !reflect.DeepEqual(capped, blocks) {
+		t.Errorf("capContentSize() = %+v, %t, want the blocks unchanged", capped, truncated)
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	if got := truncateBytes("road map", 8); got != "road map" {
+		t.Errorf("truncateBytes() = %q, want it unchanged", got)
+	}
+	if got := truncateBytes("road map", 7); got != "road…" {
+		t.Errorf("truncateBytes() = %q, want %q", got, "road…")
+	}
+	if got := truncateBytes("ééé", 5); len(got) > 5 || !utf8.ValidString(got) {
+		t.Errorf("truncateBytes() = %q, want at most 5 bytes cut at a rune boundary", got)
+	}
+}
+
+func TestOpenSpaceID(t *testing.T) {
+	cfg := newTestConfig(t, nil, "s1")
+
+	tests := []struct {
+		name      string
+		allSpaces bool
+		current   string
+		want      string
+	}{
+		{name: "all spaces use the block's space", allSpaces: true, current: "s1", want: "s3"},
+		{name: "scoped to a space", current: "s2", want: "s2"},
+		{name: "unscoped falls back to the primary space", want: "s1"},
+	}
+
+	for _, tt := range tests {
+		if got := openSpaceID(cfg, tt.allSpaces, tt.current, "s3"); got != tt.want {
+			t.Errorf("%s: openSpaceID() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newTestIndexDir returns a directory holding an empty search index for each
+// of the space IDs.
+func newTestIndexDir(t *testing.T, spaceIDs ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, spaceID := range spaceIDs {
+		writeTestIndex(t, dir, spaceID)
+	}
+	return dir
+}
+
+// writeTestIndex creates the search index of the space in dir, holding the
+// blocks in order.
+func writeTestIndex(t *testing.T, dir, spaceID string, blocks ...repository.Block) {
+	t.Helper()
+
+	db, err := sql.Open(sqliteDriver, filepath.Join(dir, "SearchIndex_"+spaceID+".sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err = db.Exec("CREATE VIRTUAL TABLE BlockSearch USING fts5(id, content, type, entityType, customRank, isTodo, isTodoChecked, documentId)"); err != nil {
+		t.Fatalf("create index of %s: %v", spaceID, err)
+	}
+	for _, block := range blocks {
+		if _, err = db.Exec("INSERT INTO BlockSearch VALUES (?, ?, '', ?, 0, 0, 0, ?)", block.ID, block.Content, block.EntityType, block.DocumentID); err != nil {
+			t.Fatalf("insert %s: %v", block.ID, err)
+		}
+	}
+}
+
+// runMain runs main in a subprocess of the test with the args and the
+// environment, and returns the items of its feedback. The test must call
+// main itself when CRAFTDOCS_TEST_MAIN is set to its name.
+func runMain(t *testing.T, name string, env ...string) []testItem {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(),
+		"CRAFTDOCS_TEST_MAIN="+name,
+		"alfred_workflow_bundleid=com.example.craftdocs.test",
+		"alfred_workflow_cache="+t.TempDir(),
+		"alfred_workflow_data="+t.TempDir(),
+	)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("main() failed: %v\n%s", err, out)
+	}
+
+	// The test binary reports PASS after the feedback
+	var feedback struct {
+		Items []testItem `json:"items"`
+	}
+	if err := json.NewDecoder(strings.NewReader(string(out))).Decode(&feedback); err != nil {
+		t.Fatalf("decoding the feedback: %v\n%s", err, out)
+	}
+	return feedback.Items
+}
+
+func TestNoResultsSuggestsAllSpaces(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == t.Name() {
+		os.Args = []string{"craftdocs", "road", "map"}
+		main()
+		return
+	}
+
+	indexDir := newTestIndexDir(t, "s1", "s2")
+	tests := []struct {
+		allSpaces string
+		want      bool
+	}{
+		{allSpaces: "0", want: true},
+		{allSpaces: "1", want: false},
+	}
+
+	for _, tt := range tests {
+		items := runMain(t, t.Name(), "INDEX_PATH_DIR="+indexDir, "allSpaces="+tt.allSpaces)
+
+		suggested, created := false, false
+		for _, item := range items {
+			if item.Title == `Search all spaces for "road map"` {
+				suggested = true
+				if item.Autocomplete != allSpacesSigil+"road map" || item.Valid {
+					t.Errorf("suggestion = %+v, want it to autocomplete %q", item, allSpacesSigil+"road map")
+				}
+			}
+			created = created || strings.HasPrefix(item.Title, "Create ")
+		}
+		if suggested != tt.want {
+			t.Errorf("allSpaces=%s: all spaces suggested = %t, want %t: %+v", tt.allSpaces, suggested, tt.want, items)
+		}
+		if !created {
+			t.Errorf("allSpaces=%s: got no create item: %+v", tt.allSpaces, items)
+		}
+	}
+}
+
+func TestRendersRepositoryOrder(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == t.Name() {
+		os.Args = []string{"craftdocs", "road"}
+		main()
+		return
+	}
+
+	indexDir := t.TempDir()
+	writeTestIndex(t, indexDir, "s1",
+		repository.Block{ID: "doc1", Content: "Road trip", EntityType: "document", DocumentID: "doc1"},
+		repository.Block{ID: "b1", Content: "old road", EntityType: "text", DocumentID: "doc1"},
+		repository.Block{ID: "b2", Content: "road", EntityType: "text", DocumentID: "doc1"},
+	)
+
+	// The block equal to the query outranks the document in the repository,
+	// and main keeps that order rather than floating documents up. REVERSE
+	// turns the whole order around.
+	tests := []struct {
+		reverse string
+		want    []string
+	}{
+		{reverse: "0", want: []string{"s1:b2", "s1:doc1", "s1:b1"}},
+		{reverse: "1", want: []string{"s1:b1", "s1:doc1", "s1:b2"}},
+	}
+
+	for _, tt := range tests {
+		items := runMain(t, t.Name(), "INDEX_PATH_DIR="+indexDir, "REVERSE="+tt.reverse)
+
+		var got []string
+		for _, item := range items {
+			if item.UID != "" && !strings.HasPrefix(item.Title, "Create ") {
+				got = append(got, item.UID)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("REVERSE=%s rendered %v, want %v", tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestAddTimings(t *testing.T) {
+	wf := newTestWorkflow(t)
+	cfg := newTestConfig(t, map[string]string{"SPACE_NAMES": "s1:Work"}, "s1", "s1||s2")
+
+	addTimings(wf, cfg, 2*time.Millisecond, service.Timings{
+		SearchTimings: repository.SearchTimings{
+			Spaces: []repository.SpaceTiming{
+				{SpaceID: "s1", Duration: 10 * time.Millisecond},
+				{SpaceID: "s2", Duration: 5 * time.Millisecond},
+			},
+			Scoring: time.Millisecond,
+		},
+		Backfill: 3 * time.Millisecond,
+	})
+
+	items := feedbackItems(t, wf)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if items[0].Title != "Search took 21ms" {
+		t.Errorf("title = %q, want the total", items[0].Title)
+	}
+	if want := "config 2ms, Work 10ms, s2 5ms, scoring 1ms, backfill 3ms"; items[0].Subtitle != want {
+		t.Errorf("subtitle = %q, want %q", items[0].Subtitle, want)
+	}
+}
+
+func TestRequiresCgo(t *testing.T) {
+	// The error of go-sqlite3's stub, built with CGO_ENABLED=0
+	stub := errors.New("Binary was compiled with 'CGO_ENABLED=0', go-sqlite3 requires cgo to work. This is a stub")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "stub", err: stub, want: true},
+		{name: "wrapped stub", err: fmt.Errorf("ping: %w", stub), want: true},
+		{name: "other error", err: errors.New("unable to open database file"), want: false},
+		{name: "no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := requiresCgo(tt.err); got != tt.want {
+			t.Errorf("%s: requiresCgo(%v) = %t, want %t", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDriver(t *testing.T) {
+	if err := checkDriver(); err != nil {
+		t.Errorf("checkDriver() error = %v, want the driver of this build to work", err)
+	}
+}
+
+func TestReverseBlocks(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5} {
+		var blocks, want []repository.Block
+		for i := 0; i < n; i++ {
+			blocks = append(blocks, repository.Block{ID: fmt.Sprint(i)})
+			want = append([]repository.Block{{ID: fmt.Sprint(i)}}, want...)
+		}
+
+		reverseBlocks(blocks)
+
+		if !reflect.DeepEqual(blocks, want) {
+			t.Errorf("reverseBlocks() of %d blocks = %+v, want %+v", n, blocks, want)
+		}
+	}
+}
+
+func TestLimitToken(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == t.Name() {
+		os.Args = []string{"craftdocs", os.Getenv("CRAFTDOCS_TEST_QUERY")}
+		main()
+		return
+	}
+
+	indexDir := t.TempDir()
+	writeTestIndex(t, indexDir, "s1",
+		repository.Block{ID: "b1", Content: "road map", EntityType: "text", DocumentID: "doc1"},
+		repository.Block{ID: "b2", Content: "road trip", EntityType: "text", DocumentID: "doc1"},
+		repository.Block{ID: "b3", Content: "road works", EntityType: "text", DocumentID: "doc1"},
+	)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "road", want: 3},
+		{query: "limit:2 road", want: 2},
+		{query: "limit:10 road", want: 3},
+		{query: "limit:0 road", want: 3},
+		{query: "limit:few road", want: 3},
+	}
+
+	for _, tt := range tests {
+		items := runMain(t, t.Name(), "INDEX_PATH_DIR="+indexDir, "CRAFTDOCS_TEST_QUERY="+tt.query)
+
+		results := 0
+		for _, item := range items {
+			if strings.HasPrefix(item.UID, "s1:") {
+				results++
+			}
+		}
+		if results != tt.want {
+			t.Errorf("%q rendered %d results, want %d: %+v", tt.query, results, tt.want, items)
+		}
+	}
+}
+
+func TestSymbolsOnly(t *testing.T) {
+	tests := []struct {
+		terms []string
+		want  bool
+	}{
+		{terms: []string{"---"}, want: true},
+		{terms: []string{"##", "**"}, want: true},
+		{terms: []string{"##", "plan"}, want: false},
+		{terms: []string{"v2.0"}, want: false},
+		{terms: []string{"café"}, want: false},
+		{terms: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := symbolsOnly(tt.terms); got != tt.want {
+			t.Errorf("symbolsOnly(%q) = %t, want %t", tt.terms, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolQuery(t *testing.T) {
+	if os.Getenv("CRAFTDOCS_TEST_MAIN") == t.Name() {
+		os.Args = []string{"craftdocs", os.Getenv("CRAFTDOCS_TEST_QUERY")}
+		main()
+		return
+	}
+
+	indexDir := t.TempDir()
+	writeTestIndex(t, indexDir, "s1",
+		repository.Block{ID: "b1", Content: "before --- after", EntityType: "text", DocumentID: "doc1"},
+		repository.Block{ID: "b2", Content: "## plan", EntityType: "text", DocumentID: "doc1"},
+	)
+
+	tests := []struct {
+		name      string
+		query     string
+		symbols   string
+		wantHint  bool
+		wantFound string
+	}{
+		{name: "symbols ask for text", query: "---", symbols: "false", wantHint: true},
+		{name: "symbols searched literally", query: "---", symbols: "true", wantFound: "s1:b1"},
+		{name: "mixed query searched", query: "## plan", symbols: "false", wantFound: "s1:b2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := runMain(t, "TestSymbolQuery", "INDEX_PATH_DIR="+indexDir,
+				"CRAFTDOCS_TEST_QUERY="+tt.query, "SYMBOL_SEARCH="+tt.symbols)
+
+			hint := len(items) == 1 && items[0].Title == "Enter some text to search"
+			if hint != tt.wantHint {
+				t.Errorf("%q rendered %+v, want the hint %t", tt.query, items, tt.wantHint)
+			}
+			if tt.wantFound == "" {
+				return
+			}
+			found := false
+			for _, item := range items {
+				found = found || item.UID == tt.wantFound
+			}
+			if !found {
+				t.Errorf("%q rendered %+v, want %s", tt.query, items, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// previewDir is the directory in the workflow cache holding the previews.
+const previewDir = "previews"
+
+// maxPreviews is the number of most recently shown previews kept in
+// previewDir, older ones are pruned after each query.
+const maxPreviews = 200
+
+// writePreview writes the full content of a result to a text file in dir,
+// named after the item UID, and returns its path. Quick Look (⇧ or ⌘Y in
+// Alfred) shows the file with its line breaks and all. A preview holding the
+// content already is only marked as used, so that retyping a query does not
+// rewrite it.
+func writePreview(dir, uid, content string) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("%x.txt", sha1.Sum([]byte(uid))))
+	if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, []byte(content)) {
+		now := time.Now()
+		return path, os.Chtimes(path, now, now)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// prunePreviews removes all but the keep most recently used previews in dir.
+func prunePreviews(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) <= keep {
+		return nil
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) <= keep {
+		return nil
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+
+	for _, info := range infos[keep:] {
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWritePreview(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), previewDir)
+
+	first, err := writePreview(dir, "s1:b1", "first\nsecond")
+	if err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	other, err := writePreview(dir, "s1:b2", "other")
+	if err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	if first == other || filepath.Dir(first) != dir {
+		t.Errorf("writePreview() paths %q and %q, want one file per item in %s", first, other, dir)
+	}
+
+	// Writing the same item again replaces its preview
+	if _, err = writePreview(dir, "s1:b1", "updated"); err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "updated" {
+		t.Errorf("preview = %q, want the latest content", data)
+	}
+}
+
+func TestWritePreviewUnchanged(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), previewDir)
+
+	path, err := writePreview(dir, "s1:b1", "text")
+	if err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Showing the same content again marks the preview as used
+	if _, err = writePreview(dir, "s1:b1", "text"); err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(old) {
+		t.Errorf("preview modified at %v, want it marked as used", info.ModTime())
+	}
+}
+
+func TestPrunePreviews(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), previewDir)
+
+	// Ten previews, each shown an hour after the one before
+	start := time.Now().Add(-24 * time.Hour)
+	paths := make([]string, 10)
+	for i := range paths {
+		path, err := writePreview(dir, fmt.Sprintf("s1:b%d", i), "text")
+		if err != nil {
+			t.Fatalf("writePreview() error = %v", err)
+		}
+		shown := start.Add(time.Duration(i) * time.Hour)
+		if err = os.Chtimes(path, shown, shown); err != nil {
+			t.Fatal(err)
+		}
+		paths[i] = path
+	}
+
+	// Showing the oldest again keeps it
+	if _, err := writePreview(dir, "s1:b0", "text"); err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := prunePreviews(dir, 4); err != nil {
+			t.Fatalf("prunePreviews() error = %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("%d previews left, want 4", len(entries))
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if kept := err == nil; kept != (i == 0 || i >= 7) {
+			t.Errorf("preview %d kept = %t, want the most recently shown", i, kept)
+		}
+	}
+}
+
+func TestPrunePreviewsMissingDir(t *testing.T) {
+	if err := prunePreviews(filepath.Join(t.TempDir(), previewDir), maxPreviews); err != nil {
+		t.Errorf("prunePreviews() error = %v, want none before any preview", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/cache"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+// queryCacheKey is the workflow cache entry holding recent search results.
+const queryCacheKey = "query_results.json"
+
+// queryCacheSize is the number of recent queries whose results are kept.
+const queryCacheSize = 20
+
+// cachedQuery holds the ranked results of one query, valid as long as the
+// search indexes are not modified after IndexModTime.
+type cachedQuery struct {
+	Key          string             `json:"key"`
+	StoredAt     time.Time          `json:"storedAt"`
+	IndexModTime time.Time          `json:"indexModTime"`
+	Blocks       []repository.Block `json:"blocks"`
+}
+
+// queryResultKey identifies a query by its normalized terms and the options
+// that shape its results.
+func queryResultKey(terms []string, opts repository.SearchOptions) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(strings.Join(terms, " ")), " "))
+	return fmt.Sprintf("%q|%+v", normalized, opts)
+}
+
+// loadQueryResults returns the results stored for the key when they are
+// younger than ttl and the search indexes have not changed since.
+func loadQueryResults(store cache.Store, key string, indexModTime time.Time, ttl time.Duration) ([]repository.Block, bool) {
+	var entries []cachedQuery
+	if err := store.LoadJSON(queryCacheKey, &entries); err != nil {
+		return nil, false
+	}
+
+	for _, entry := range entries {
+		if entry.Key != key {
+			continue
+		}
+		if time.Since(entry.StoredAt) > ttl || !entry.IndexModTime.Equal(indexModTime) {
+			return nil, false
+		}
+
+		log.Printf("Using cached results from %s", entry.StoredAt.Format(time.RFC3339))
+		return entry.Blocks, true
+	}
+
+	return nil, false
+}
+
+// storeQueryResults remembers the results of the query, dropping expired
+// entries and the oldest ones beyond queryCacheSize.
+func storeQueryResults(store cache.Store, key string, indexModTime time.Time, ttl time.Duration, blocks []repository.Block) {
+	var entries []cachedQuery
+	_ = store.LoadJSON(queryCacheKey, &entries)
+
+	kept := []cachedQuery{{Key: key, StoredAt: time.Now(), IndexModTime: indexModTime, Blocks: blocks}}
+	for _, entry := range entries {
+		if entry.Key == key || time.Since(entry.StoredAt) > ttl {
+			continue
+		}
+		if len(kept) == queryCacheSize {
+			break
+		}
+		kept = append(kept, entry)
+	}
+
+	_ = store.StoreJSON(queryCacheKey, kept)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+func TestLoadQueryResultsWithinTTL(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	opts := repository.SearchOptions{CurrentSpaceID: "s1"}
+
+	storeQueryResults(store, queryResultKey([]string{"road", "map"}, opts), modTime, time.Minute, []repository.Block{
+		{ID: "b1", SpaceID: "s1", Content: "road map"},
+	})
+
+	// Retyping the query with other spacing or case hits the same entry
+	blocks, ok := loadQueryResults(store, queryResultKey([]string{"Road ", " map"}, opts), modTime, time.Minute)
+	if !ok {
+		t.Fatal("loadQueryResults() missed results stored within the TTL")
+	}
+	if len(blocks) != 1 || blocks[0].ID != "b1" {
+		t.Errorf("loadQueryResults() = %+v, want the stored block", blocks)
+	}
+}
+
+func TestLoadQueryResultsScope(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Now()
+
+	storeQueryResults(store, queryResultKey([]string{"plan"}, repository.SearchOptions{CurrentSpaceID: "s1"}), modTime, time.Minute, []repository.Block{{ID: "b1"}})
+
+	if _, ok := loadQueryResults(store, queryResultKey([]string{"plan"}, repository.SearchOptions{CurrentSpaceID: "s2"}), modTime, time.Minute); ok {
+		t.Error("loadQueryResults() used results of another scope")
+	}
+}
+
+func TestLoadQueryResultsIndexChanged(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Now()
+	key := queryResultKey([]string{"plan"}, repository.SearchOptions{})
+
+	storeQueryResults(store, key, modTime, time.Minute, []repository.Block{{ID: "b1"}})
+
+	if _, ok := loadQueryResults(store, key, modTime.Add(time.Second), time.Minute); ok {
+		t.Error("loadQueryResults() used results stored before the index changed")
+	}
+}
+
+func TestLoadQueryResultsExpired(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Now()
+	key := queryResultKey([]string{"plan"}, repository.SearchOptions{})
+
+	if err := store.StoreJSON(queryCacheKey, []cachedQuery{
+		{Key: key, StoredAt: time.Now().Add(-time.Hour), IndexModTime: modTime, Blocks: []repository.Block{{ID: "b1"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := loadQueryResults(store, key, modTime, time.Minute); ok {
+		t.Error("loadQueryResults() used results older than the TTL")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/cache"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+)
+
+// refreshArg is the query that rebuilds the workflow caches.
+const refreshArg = "--refresh"
+
+// refreshCaches drops every cache entry of the workflow and rebuilds the ones
+// that do not depend on a query. It only reads the search indexes, so it is
+// safe to run while Craft is open.
+func refreshCaches(wf *aw.Workflow, store cache.Soft) {
+	start := time.Now()
+
+	for _, key := range []string{config.IndexCacheKey, documentTitlesCacheKey, queryCacheKey} {
+		if err := store.Delete(key); err != nil {
+			wf.NewWarningItem("Clearing "+key+" failed", err.Error())
+			continue
+		}
+		wf.NewItem("Cleared " + key).Valid(false)
+	}
+
+	if err := os.RemoveAll(filepath.Join(wf.CacheDir(), previewDir)); err != nil {
+		wf.NewWarningItem("Clearing "+previewDir+" failed", err.Error())
+	} else {
+		wf.NewItem("Cleared " + previewDir).Valid(false)
+	}
+
+	cfg, err := config.NewConfig(store)
+	if err != nil {
+		wf.NewWarningItem("Rediscovering search indexes failed", err.Error())
+		return
+	}
+	wf.NewItem(fmt.Sprintf("Found %d search indexes", len(cfg.SearchIndexes()))).
+		Subtitle(cfg.IndexPathDir).
+		Valid(false)
+
+	wf.NewItem(fmt.Sprintf("Refreshed in %s", time.Since(start).Round(time.Millisecond))).
+		Subtitle("Document titles are warmed again by the next search").
+		Valid(false)
+}
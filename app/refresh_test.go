@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/cache"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+func TestRefreshCaches(t *testing.T) {
+	cfg := newTestConfig(t, nil, "s1")
+	wf := newTestWorkflow(t)
+	store := cache.NewSoft(wf.Cache, false)
+
+	if err := store.StoreJSON(config.IndexCacheKey, map[string]string{"Dir": "/stale"}); err != nil {
+		t.Fatal(err)
+	}
+	warmDocumentTitles(store, time.Now(), []repository.Block{{ID: "b1", DocumentID: "doc1", SpaceID: "s1", DocumentTitle: "Plan"}})
+	if _, err := writePreview(filepath.Join(wf.CacheDir(), previewDir), "s1:b1", "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshCaches(wf, store)
+
+	var indexes struct{ Dir string }
+	if err := store.LoadJSON(config.IndexCacheKey, &indexes); err != nil {
+		t.Fatalf("the index cache was not rebuilt: %v", err)
+	}
+	if indexes.Dir != cfg.IndexPathDir {
+		t.Errorf("index cache dir = %q, want it rediscovered in %q", indexes.Dir, cfg.IndexPathDir)
+	}
+	var titles warmedTitles
+	if err := store.LoadJSON(documentTitlesCacheKey, &titles); err == nil {
+		t.Error("the warmed titles survived the refresh")
+	}
+	if _, err := os.Stat(filepath.Join(wf.CacheDir(), previewDir)); !os.IsNotExist(err) {
+		t.Errorf("the previews survived the refresh: %v", err)
+	}
+
+	items := feedbackItems(t, wf)
+	if len(items) == 0 || !strings.HasPrefix(items[len(items)-1].Title, "Refreshed in ") {
+		t.Errorf("items = %+v, want the time taken last", items)
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// attachmentColumnNames are the names the search index may give the file
+// name of a block embedding a file.
+var attachmentColumnNames = map[string]bool{
+	"filename":       true,
+	"filenames":      true,
+	"attachment":     true,
+	"attachmentname": true,
+	"file":           true,
+}
+
+// resolveAttachmentColumns finds the content table column holding the file
+// name of a file block in every space.
+func (b *BlockRepo) resolveAttachmentColumns(ctx context.Context, spaces []Space) error {
+	if b.attachmentColumns == nil {
+		b.attachmentColumns = make(map[string]string)
+	}
+	return b.resolveColumns(ctx, spaces, b.attachmentColumns, attachmentColumnNames, "File search unavailable", "attachment file name")
+}
+
+// backfillAttachments sets Attachment of the blocks to the name of the file
+// they embed. Only spaces searched by file name are looked up.
+func (b *BlockRepo) backfillAttachments(ctx context.Context, blocks []Block) error {
+	idsBySpace := make(map[string][]interface{})
+	for _, block := range blocks {
+		if _, ok := b.attachmentColumns[block.SpaceID]; ok {
+			idsBySpace[block.SpaceID] = append(idsBySpace[block.SpaceID], block.ID)
+		}
+	}
+
+	names := make(map[string]string)
+	for _, space := range b.spaces {
+		ids := idsBySpace[space.ID]
+		if len(ids) == 0 {
+			continue
+		}
+
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = "?" + strconv.Itoa(i+1)
+		}
+
+		query := `select c0 as id, ` + b.attachmentColumns[space.ID] + ` as name from ` + b.contentTableExpr(ctx, space) + ` where c0 in (` + strings.Join(placeholders, ", ") + ")"
+		rows, err := space.DB.QueryContext(ctx, query, ids...)
+		if err != nil {
+			return types.NewError("failed to query attachment names", err)
+		}
+
+		for rows.Next() {
+			var id string
+			var name sql.NullString
+
+			if err = rows.Scan(&id, &name); err != nil {
+				_ = rows.Close()
+				return types.NewError("failed to scan row", err)
+			}
+
+			if name.Valid && strings.TrimSpace(name.String) != "" {
+				names[DocumentKey(space.ID, id)] = strings.TrimSpace(name.String)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return types.NewError("error in rows", err)
+		}
+
+		if err = rows.Close(); err != nil {
+			return types.NewError("closing rows failed", err)
+		}
+	}
+
+	for i, block := range blocks {
+		blocks[i].Attachment = names[DocumentKey(block.SpaceID, block.ID)]
+	}
+
+	return nil
+}
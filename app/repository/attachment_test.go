@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// fileBlock returns the row of a block of the document embedding a file.
+func fileBlock(id, content, documentID, fileName string) testRow {
+	row := block(id, content, documentID)
+	row.FileName = fileName
+	return row
+}
+
+func TestSearchFile(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Finance"),
+		fileBlock("b1", "Q3 numbers", "doc1", "Report-Q3.pdf"),
+		fileBlock("b2", "Q3 slides", "doc1", "slides.key"),
+		block("b3", "the Q3 report is due", "doc1"),
+	))
+
+	tests := []struct {
+		name  string
+		terms []string
+		file  string
+		want  []string
+	}{
+		{name: "file name only", file: "report", want: []string{DocumentKey("s1", "b1")}},
+		{name: "file name and terms", terms: []string{"q3"}, file: ".key", want: []string{DocumentKey("s1", "b2")}},
+		{name: "no such file", terms: []string{"q3"}, file: "budget", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), tt.terms, SearchOptions{CurrentSpaceID: "s1", File: tt.file})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if got := keys(blocks); !equalStrings(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackfillAttachments(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Finance"),
+		fileBlock("b1", "Q3 numbers", "doc1", " Report-Q3.pdf "),
+		block("b2", "Q3 notes", "doc1"),
+	))
+
+	found, err := repo.Search(context.Background(), []string{"q3"}, SearchOptions{CurrentSpaceID: "s1", File: "pdf"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	blocks, err := repo.BackfillDocumentNames(context.Background(), append(found, Block{ID: "b2", DocumentID: "doc1", SpaceID: "s1"}), map[string]struct{}{"s1": {}})
+	if err != nil {
+		t.Fatalf("BackfillDocumentNames() error = %v", err)
+	}
+
+	for i, want := range []string{"Report-Q3.pdf", ""} {
+		if blocks[i].Attachment != want {
+			t.Errorf("attachment of %s = %q, want %q", blocks[i].ID, blocks[i].Attachment, want)
+		}
+	}
+}
+
+func TestSearchFileUnavailable(t *testing.T) {
+	repo := NewBlockRepo(newBareSpace(t, "s1", "id", "content", "type", "entityType", "customRank", "isTodo", "isTodoChecked", "documentId"))
+
+	_, err := repo.Search(context.Background(), []string{"q3"}, SearchOptions{CurrentSpaceID: "s1", File: "report"})
+
+	var te types.Error
+	if !errors.As(err, &te) || te.Title != "File search unavailable" {
+		t.Errorf("Search() error = %v, want the file search reported unavailable", err)
+	}
+}
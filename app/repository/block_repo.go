@@ -3,19 +3,25 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
 )
 
 const (
-	// Fetch more results for better fuzzy matching (similar to Bear workflow)
+	// Fetch more results for better fuzzy matching (similar to Bear workflow).
+	// It is the default of SearchOptions.FetchLimit.
 	searchFetchLimit = 200
-	// Display limit for final results
+	// Display limit for final results, the default of
+	// SearchOptions.ResultLimit
 	searchResultLimit = 40
 )
 
@@ -25,11 +31,106 @@ type Space struct {
 }
 
 type BlockRepo struct {
-	spaces []Space
+	spaces            []Space
+	timedOut          []string          // spaces skipped by the last Search
+	starredColumns    map[string]string // starred flag column by space ID
+	folderColumns     map[string]string // document folder column by space ID
+	attachmentColumns map[string]string // attachment file name column by space ID
+	timings           SearchTimings     // phase durations of the last Search
+	contentTables     map[string]string // table searched by space ID, see contentTableExpr
+	scorer            Scorer            // ranks the results, MatchTiers by default
+	knownTitles       map[string]string // document titles by DocumentKey, see WithDocumentTitles
 }
 
 func NewBlockRepo(spaces ...Space) *BlockRepo {
-	return &BlockRepo{spaces: spaces}
+	return &BlockRepo{spaces: spaces, scorer: MatchTiers{}}
+}
+
+// SpaceTiming is the time spent querying a space.
+type SpaceTiming struct {
+	SpaceID  string
+	Duration time.Duration
+}
+
+// SearchTimings are the durations of the phases of a Search.
+type SearchTimings struct {
+	Spaces  []SpaceTiming // time spent querying each space, over all passes
+	Scoring time.Duration // scoring, filtering and ranking the candidates
+}
+
+// Timings returns the phase durations of the last Search.
+func (b *BlockRepo) Timings() SearchTimings {
+	return b.timings
+}
+
+// addSpaceTime adds d to the time spent querying the space.
+func (b *BlockRepo) addSpaceTime(spaceID string, d time.Duration) {
+	for i := range b.timings.Spaces {
+		if b.timings.Spaces[i].SpaceID == spaceID {
+			b.timings.Spaces[i].Duration += d
+			return
+		}
+	}
+	b.timings.Spaces = append(b.timings.Spaces, SpaceTiming{SpaceID: spaceID, Duration: d})
+}
+
+// ScoreQuery is the query a Scorer ranks the results against.
+type ScoreQuery struct {
+	Phrase string   // the query words joined by a space
+	Words  []string // the query words, without #tags
+	Tags   []string // the queried #tags, without the hash
+}
+
+// Scorer ranks search results. Blocks with a higher score come first; blocks
+// scoring the same are ordered by the built-in tie-breaks, such as documents
+// before blocks, so a Scorer may only tell some results apart. The Match of
+// the block tells how it matched the query.
+type Scorer interface {
+	Score(block Block, query ScoreQuery) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface.
+type ScorerFunc func(block Block, query ScoreQuery) float64
+
+// Score returns f(block, query).
+func (f ScorerFunc) Score(block Block, query ScoreQuery) float64 {
+	return f(block, query)
+}
+
+// MatchTiers is the default Scorer. It ranks the results by how closely they
+// match the query: the whole content equal to it, then whole numbers and
+// #tags matched, the exact phrase, the words in order, all the words, and an
+// acronym of the title.
+type MatchTiers struct{}
+
+// Score returns the match tiers of the block as bits, the best tier highest.
+func (MatchTiers) Score(block Block, _ ScoreQuery) float64 {
+	var score float64
+	for _, tier := range []bool{
+		block.Match.EqualMatch,
+		block.Match.StandaloneNumbers,
+		block.Match.TagMatch,
+		block.Match.ExactMatch,
+		block.Match.OrderedWordsMatch,
+		block.Match.AllWordsMatch,
+		block.Match.Acronym,
+	} {
+		score *= 2
+		if tier {
+			score++
+		}
+	}
+	return score
+}
+
+// WithScorer makes Search rank its results with the scorer. A nil scorer
+// restores the default, MatchTiers.
+func (b *BlockRepo) WithScorer(scorer Scorer) *BlockRepo {
+	if scorer == nil {
+		scorer = MatchTiers{}
+	}
+	b.scorer = scorer
+	return b
 }
 
 func (br *BlockRepo) Close() (err error) {
@@ -42,27 +143,178 @@ func (br *BlockRepo) Close() (err error) {
 	return err
 }
 
+// SearchOptions narrows down what Search looks at.
+type SearchOptions struct {
+	AllSpaces      bool   // search every space instead of CurrentSpaceID
+	Daily          bool   // include daily notes (date-titled documents)
+	CurrentSpaceID string // space searched when AllSpaces is false
+	PrimarySpaceID string // space ranked first among equal results of several spaces
+	DocumentID     string // restricts results to the blocks of one document
+	// SpaceTimeout bounds every query on a single space. Spaces exceeding it
+	// are skipped and reported by TimedOutSpaces. Zero disables the bound.
+	SpaceTimeout time.Duration
+	// StarredOnly restricts results to starred documents and their blocks.
+	StarredOnly bool
+	// FolderID restricts results to the documents in the folder and their
+	// blocks. Subfolders are not included.
+	FolderID string
+	// FolderPath restricts results to the documents whose folder holds the
+	// segments in order, ignoring case, and their blocks. The index records
+	// a folder value per document but no folder tree, so the segments are
+	// matched within that value rather than against the names of the parent
+	// folders: ["work", "projects"] matches "Work Projects", not "Projects".
+	FolderPath []string
+	// File restricts results to blocks embedding a file whose name contains
+	// it, ignoring case.
+	File string
+	// RawMatch searches for the terms literally: no #tag parsing, and LIKE
+	// wildcards in the terms match themselves.
+	RawMatch bool
+	// RecencyWeight is the ranking penalty per year of document age, applied
+	// between results of the same match quality. Zero disables it.
+	RecencyWeight float64
+	// SortBy orders the results: SortByModified by the modification time of
+	// their documents, newest first, SortByRelevance or empty by match.
+	SortBy string
+	// ModifiedColumn names the modification timestamp column of the search
+	// index. Empty looks for the known names.
+	ModifiedColumn string
+	// DocPriority is how documents rank against blocks: DocPriorityStrict
+	// puts them above all blocks, DocPriorityRelevance only above blocks of
+	// the same match tier. Empty means relevance.
+	DocPriority string
+	// RecentBy is the timestamp ordering the recent documents of an empty
+	// query, RecentByModified or RecentByCreated.
+	RecentBy string
+	// TitleWeight is the weight of a query word matched in a document title,
+	// relative to a word matched in block content. Blocks count the words in
+	// the title of their document.
+	TitleWeight float64
+	// JoinedMatch also finds documents whose words are spread over several
+	// of their blocks. It costs a query per candidate document.
+	JoinedMatch bool
+	// Subsequence also finds document titles holding the query characters in
+	// order, not necessarily adjacent, such as "prjpln" for "Project Plan".
+	Subsequence bool
+	// Acronym also finds document titles whose word initials start with the
+	// query, such as "prd" for "Product Requirements Doc".
+	Acronym bool
+	// NumericBoundary ranks numeric query words found as whole numbers above
+	// those embedded in longer numbers.
+	NumericBoundary bool
+	// BodyOnly leaves documents out of the fetched candidates, so that only
+	// blocks whose content holds the terms are found, never a title alone.
+	BodyOnly bool
+	// DocumentsOnly leaves blocks out of the fetched candidates, so that only
+	// document titles are found.
+	DocumentsOnly bool
+	// EarlyMatch ranks results whose first matched word appears earlier in
+	// the content higher, between results of the same match quality.
+	EarlyMatch bool
+	// MatchRatio is the fraction of the query words a result of a multi-word
+	// query must contain. Zero requires all of them, like 1.
+	MatchRatio float64
+	// WordPassThreshold skips the per-word pass on a space whose first pass
+	// found at least this many candidates. Zero always runs the pass.
+	WordPassThreshold int
+	// MaxWordPasses caps the (word, space) queries of the per-word pass. The
+	// longest words, likely the rarest, run first. Zero means no cap.
+	MaxWordPasses int
+	// DisablePhrasePass skips searching for all the words of a multi-word
+	// query at once. A single word is always searched for.
+	DisablePhrasePass bool
+	// DisableWordPass skips searching for every word of the query alone.
+	DisableWordPass bool
+	// Todo restricts results to checklist items in the given state, either
+	// TodoOpen or TodoDone. Empty includes every block.
+	Todo string
+	// FoldDiacritics matches the terms ignoring diacritics, so that "cafe"
+	// finds "café". The connections need FoldFunction registered.
+	FoldDiacritics bool
+	// ResultLimit caps the results of a search, FetchLimit the candidates
+	// read from a space per query. Zero means the defaults, 40 and 200.
+	ResultLimit int
+	FetchLimit  int
+	// Regex searches for blocks matching the regular expression instead of
+	// the terms. An expression that does not start with a literal reads
+	// every block of the scope.
+	Regex string
+	// regexScan lists the blocks of the scope when the regular expression
+	// has no literal to search for.
+	regexScan bool
+	// offset skips the first rows of the query, to read it in batches.
+	offset int
+	// subsequence is the pattern of the subsequence pass.
+	subsequence string
+	// Phrase is the exact phrase to rank by, when it differs from the terms
+	// joined by spaces, such as after repeated terms were dropped.
+	Phrase string
+}
+
 type Block struct {
-	ID           string
-	SpaceID      string
-	Content      string
-	EntityType   string
-	DocumentID   string
-	DocumentName string
+	ID             string
+	SpaceID        string
+	Content        string
+	EntityType     string
+	DocumentID     string
+	DocumentName   string
+	DocumentTitle  string    // title of the document the block belongs to
+	ModifiedAt     time.Time // modification time of the document, if known
+	DocumentIcon   string    // icon or emoji of the document, if any
+	HeadingContext string    // nearest heading above the block, see BackfillHeadings
+	ReferenceID    string    // document a linked reference block points to
+	Attachment     string    // name of the file the block embeds, for file searches
+	Match          Match
+}
+
+// Match describes how a block matched the search query. It is left empty for
+// blocks listed without a query.
+type Match struct {
+	EqualMatch        bool // the whole content equals the query
+	ExactMatch        bool
+	OrderedWordsMatch bool
+	AllWordsMatch     bool
+	TagMatch          bool     // content carries every queried #tag
+	StandaloneNumbers bool     // numeric query words appear as whole numbers
+	JoinedMatch       bool     // the words are spread over the document's blocks
+	Subsequence       bool     // the title holds the query characters in order
+	Acronym           bool     // the initials of the title's words start with the query
+	MatchedWords      []string // query words found in the content
 }
 
 func (b *Block) IsDocument() bool {
 	return b.EntityType == "document"
 }
 
+// IsHeading reports whether the block is a heading, either by its entity type
+// or by its Markdown heading markup, such as "## Risks".
+func (b *Block) IsHeading() bool {
+	if strings.Contains(strings.ToLower(b.EntityType), "heading") {
+		return true
+	}
+
+	level := len(b.Content) - len(strings.TrimLeft(b.Content, "#"))
+	return level > 0 && level <= 6 && strings.HasPrefix(b.Content[level:], " ")
+}
+
 // blockRecord holds a block along with its match quality scores
 type blockRecord struct {
-	block                Block
-	isDocument           bool
-	exactMatch           bool // title contains exact search phrase
-	orderedWordsMatch    bool // title contains all words in order
-	allWordsMatch        bool // title contains all words (any order)
-	originalIndex        int
+	block             Block
+	isDocument        bool
+	equalMatch        bool    // title equals the search phrase
+	exactMatch        bool    // title contains exact search phrase
+	orderedWordsMatch bool    // title contains all words in order
+	adjacency         float64 // phrase length over the span of the ordered words, 1 when contiguous
+	allWordsMatch     bool    // title contains all words (any order)
+	tagMatch          bool    // content carries every queried #tag
+	recencyPenalty    float64
+	wordScore         float64 // matched words, title words weighted by TitleWeight
+	acronymMatch      bool    // the title's word initials start with the query
+	subsequenceScore  float64 // fallback when the title holds the query characters in order
+	numbersStandalone bool    // numeric query words appear as whole numbers
+	score             float64 // score given by the Scorer
+	firstMatch        int     // byte offset of the earliest matched word
+	originalIndex     int
 }
 
 // isDateTitle checks if the content matches the date pattern YYYY.MM.DD
@@ -75,6 +327,19 @@ func isDateTitle(content string) bool {
 		isDigits(content[0:4]) && isDigits(content[5:7]) && isDigits(content[8:10])
 }
 
+// parseDateTitle reads the date of a daily note from its YYYY.MM.DD title.
+func parseDateTitle(content string) (time.Time, bool) {
+	if !isDateTitle(content) {
+		return time.Time{}, false
+	}
+
+	date, err := time.ParseInLocation("2006.01.02", content, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
 // isDigits checks if all characters in the string are digits
 func isDigits(s string) bool {
 	for _, c := range s {
@@ -85,17 +350,22 @@ func isDigits(s string) bool {
 	return true
 }
 
-// containsOrderedWords checks if text contains all words in the given order
-func containsOrderedWords(text string, words []string) bool {
-	prevPos := 0
+// containsOrderedWords checks if text contains all words in the given order.
+// It also returns the span from the start of the first word to the end of the
+// last one, in bytes.
+func containsOrderedWords(text string, words []string) (bool, int) {
+	prevPos, start := 0, -1
 	for _, word := range words {
 		pos := strings.Index(text[prevPos:], word)
 		if pos == -1 {
-			return false
+			return false, 0
+		}
+		if start < 0 {
+			start = prevPos + pos
 		}
 		prevPos += pos + len(word)
 	}
-	return true
+	return true, prevPos - start
 }
 
 // containsAllWords checks if text contains all the given words (in any order)
@@ -108,32 +378,270 @@ func containsAllWords(text string, words []string) bool {
 	return true
 }
 
+// searchQuery holds the lowercased query parts used for scoring.
+type searchQuery struct {
+	phrase      string   // plain words joined by a space
+	words       []string // plain words
+	tags        []string // hashtags without the leading '#'
+	titleWeight float64  // weight of a word matched in a document title
+	fold        bool     // compare with diacritics folded, see FoldDiacritics
+}
+
+// newSearchQuery separates hashtag terms from plain words. A lone "#" is kept
+// as a plain word.
+func newSearchQuery(terms []string) searchQuery {
+	var q searchQuery
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if len(term) > 1 && term[0] == '#' {
+			q.tags = append(q.tags, term[1:])
+			continue
+		}
+		q.words = append(q.words, term)
+	}
+	q.phrase = strings.Join(q.words, " ")
+	return q
+}
+
+// subsequencePattern builds a LIKE pattern matching text that holds the
+// characters of pattern in order.
+func subsequencePattern(pattern string) string {
+	var b strings.Builder
+	b.WriteString("%")
+	for _, r := range pattern {
+		b.WriteString(escapeLike(string(r)))
+		b.WriteString("%")
+	}
+	return b.String()
+}
+
+// acronymMatch reports whether the initials of the words of text start with
+// pattern, such as "prd" for "Product Requirements Doc".
+func acronymMatch(text, pattern string) bool {
+	if len(pattern) < 2 {
+		return false
+	}
+
+	var initials strings.Builder
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		r, _ := utf8.DecodeRuneInString(word)
+		initials.WriteRune(unicode.ToLower(r))
+	}
+
+	return strings.HasPrefix(initials.String(), pattern)
+}
+
+// subsequenceScore scores how well text holds the characters of pattern in
+// order, like editor fuzzy finders do. Characters at word boundaries and
+// runs of adjacent characters score higher. It returns 0 when text does not
+// hold the pattern.
+func subsequenceScore(text, pattern string) float64 {
+	want := []rune(pattern)
+	if len(want) == 0 {
+		return 0
+	}
+
+	score := 0.0
+	matched := 0
+	prevMatched := false
+	prev := ' '
+	for _, r := range text {
+		if matched < len(want) && r == want[matched] {
+			score++
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 2 // start of a word
+			}
+			if prevMatched {
+				score++ // adjacent to the previous match
+			}
+			matched++
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+		prev = r
+	}
+
+	if matched < len(want) {
+		return 0
+	}
+
+	// Favor tight matches in short titles
+	return score / float64(len([]rune(text)))
+}
+
+// newRawSearchQuery keeps every term as a plain word, so that markdown such
+// as "#" headings or "- [ ]" checkboxes is searched for as written.
+func newRawSearchQuery(terms []string) searchQuery {
+	var q searchQuery
+	for _, term := range terms {
+		q.words = append(q.words, strings.ToLower(term))
+	}
+	q.phrase = strings.Join(q.words, " ")
+	return q
+}
+
+// fetchTerms returns the terms the database is queried with. Tags are fetched
+// by name so that tagged blocks and plain mentions are both candidates.
+func (q searchQuery) fetchTerms() []string {
+	terms := make([]string, 0, len(q.words)+len(q.tags))
+	terms = append(terms, q.words...)
+	return append(terms, q.tags...)
+}
+
+// containsTag checks if text carries the tag as "#tag" followed by a
+// character that cannot be part of a tag name.
+func containsTag(text, tag string) bool {
+	needle := "#" + tag
+	for offset := 0; ; {
+		pos := strings.Index(text[offset:], needle)
+		if pos == -1 {
+			return false
+		}
+		end := offset + pos + len(needle)
+		if end == len(text) || !isTagRune(rune(text[end])) {
+			return true
+		}
+		offset += pos + 1
+	}
+}
+
+// containsStandaloneNumber checks if text holds number with no digit right
+// before or after it, so "2024" is found in "2024.01.05" but not in "120245".
+func containsStandaloneNumber(text, number string) bool {
+	for offset := 0; ; {
+		pos := strings.Index(text[offset:], number)
+		if pos == -1 {
+			return false
+		}
+		start := offset + pos
+		end := start + len(number)
+		if (start == 0 || !isDigits(text[start-1:start])) && (end == len(text) || !isDigits(text[end:end+1])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// Checklist states of a todo block.
+const (
+	TodoOpen = "open"
+	TodoDone = "done"
+)
+
+// todoState reads the checklist state from the "[ ]" or "[x]" markup at the
+// start of the content, after an optional list bullet. It is empty for
+// blocks that are not todos.
+func todoState(content string) string {
+	content = strings.TrimSpace(content)
+	for _, bullet := range []string{"- ", "* "} {
+		content = strings.TrimPrefix(content, bullet)
+	}
+
+	switch {
+	case strings.HasPrefix(content, "[ ]"):
+		return TodoOpen
+	case strings.HasPrefix(content, "[x]"), strings.HasPrefix(content, "[X]"):
+		return TodoDone
+	}
+	return ""
+}
+
+// isTagRune reports whether r may continue a tag name.
+func isTagRune(r rune) bool {
+	return r == '_' || r == '-' || r == '/' || unicode.IsLetter(r) || unicode.IsDigit(r) || r >= utf8.RuneSelf
+}
+
 // scoreBlock creates a blockRecord with match quality scores for the given block
-func scoreBlock(block Block, searchPhrase string, searchWords []string, index int) blockRecord {
+func scoreBlock(block Block, q searchQuery, index int) blockRecord {
 	lowerContent := strings.ToLower(block.Content)
-	
+	if q.fold {
+		lowerContent = FoldDiacritics(block.Content)
+	}
+	searchWords := q.words
+
 	record := blockRecord{
 		block:         block,
 		isDocument:    block.IsDocument(),
-		exactMatch:    strings.Contains(lowerContent, searchPhrase),
+		equalMatch:    q.phrase != "" && strings.TrimSpace(lowerContent) == q.phrase,
+		exactMatch:    strings.Contains(lowerContent, q.phrase),
 		originalIndex: index,
 	}
-	
+
+	if len(q.tags) > 0 {
+		record.tagMatch = true
+		for _, tag := range q.tags {
+			if !containsTag(lowerContent, tag) {
+				record.tagMatch = false
+				break
+			}
+		}
+	}
+
 	if len(searchWords) > 1 {
-		record.orderedWordsMatch = containsOrderedWords(lowerContent, searchWords)
+		var span int
+		record.orderedWordsMatch, span = containsOrderedWords(lowerContent, searchWords)
+		if record.orderedWordsMatch && span > 0 {
+			record.adjacency = float64(len(q.phrase)) / float64(span)
+			if record.adjacency > 1 {
+				record.adjacency = 1
+			}
+		}
 		record.allWordsMatch = containsAllWords(lowerContent, searchWords)
 	} else {
 		// Single word search - exact match is the same as ordered/all words match
 		record.orderedWordsMatch = record.exactMatch
 		record.allWordsMatch = record.exactMatch
+		if record.exactMatch {
+			record.adjacency = 1
+		}
+	}
+
+	record.block.Match = Match{
+		EqualMatch:        record.equalMatch,
+		ExactMatch:        record.exactMatch,
+		OrderedWordsMatch: record.orderedWordsMatch,
+		AllWordsMatch:     record.allWordsMatch,
+		TagMatch:          record.tagMatch,
 	}
-	
+	// Words in the document title weigh TitleWeight: a document row holds
+	// its title, a block carries the title of its document
+	var title string
+	if q.titleWeight > 0 {
+		switch {
+		case record.isDocument:
+			title = lowerContent
+		case q.fold:
+			title = FoldDiacritics(block.DocumentTitle)
+		default:
+			title = strings.ToLower(block.DocumentTitle)
+		}
+	}
+
+	record.firstMatch = len(lowerContent)
+	for _, word := range searchWords {
+		weight := 0.0
+		if i := strings.Index(lowerContent, word); i >= 0 {
+			record.block.Match.MatchedWords = append(record.block.Match.MatchedWords, word)
+			weight = 1
+			if i < record.firstMatch {
+				record.firstMatch = i
+			}
+		}
+		if title != "" && strings.Contains(title, word) {
+			weight = q.titleWeight
+		}
+		record.wordScore += weight
+	}
+
 	return record
 }
 
-// filterDateTitles removes documents with date-like titles and returns exactly searchResultLimit items
+// filterDateTitles removes documents with date-like titles and returns at most limit items
 // If daily is true, date-titled documents are included in results
-func (b *BlockRepo) filterDateTitles(blocks []Block, daily bool) []Block {
+func (b *BlockRepo) filterDateTitles(blocks []Block, daily bool, limit int) []Block {
 	filtered := make([]Block, 0, len(blocks))
 
 	for _, block := range blocks {
@@ -144,7 +652,7 @@ func (b *BlockRepo) filterDateTitles(blocks []Block, daily bool) []Block {
 		filtered = append(filtered, block)
 
 		// Stop once we have enough results
-		if len(filtered) >= searchResultLimit {
+		if len(filtered) >= limit {
 			break
 		}
 	}
@@ -152,209 +660,947 @@ func (b *BlockRepo) filterDateTitles(blocks []Block, daily bool) []Block {
 	return filtered
 }
 
+// likeEscaper escapes the LIKE wildcards, using a backslash as escape.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
+func escapeLike(term string) string {
+	return likeEscaper.Replace(term)
+}
 
-func (b *BlockRepo) searchWithLike(ctx context.Context, space Space, terms []string, limit int) (*sql.Rows, error) {
+func (b *BlockRepo) searchWithLike(ctx context.Context, space Space, terms []string, opts SearchOptions, limit int) (*sql.Rows, error) {
 	// Build LIKE query for searching content
 	// Try multiple table names in case the structure varies
-	tableNames := []string{"BlockSearch_content"}
+	tableNames := []string{b.contentTableExpr(ctx, space)}
 
+	var lastErr error
 	for _, tableName := range tableNames {
-		var query string
-		var args []interface{}
+		// Filter out empty content
+		conditions := []string{"c1 IS NOT NULL AND length(c1) > 0"}
+		args := make([]interface{}, 0, len(terms)+2)
+		// Without an explicit order, LIMIT may cut at a different place
+		// from one run to the next
+		order := "ORDER BY rowid"
+
+		if opts.DocumentID != "" {
+			conditions = append(conditions, "c7 = ?")
+			args = append(args, opts.DocumentID)
+		}
 
-		if len(terms) == 0 {
-			// No search terms, return recent documents only (not individual blocks)
-			query = fmt.Sprintf(`
-				SELECT c0 as id, c1 as content, c3 as entityType, c7 as documentId 
-				FROM %s 
-				WHERE c3 = 'document' AND c1 IS NOT NULL AND length(c1) > 0
-				ORDER BY c0 DESC
-				LIMIT ?
-			`, tableName)
-			args = []interface{}{limit}
-		} else {
-			conditions := make([]string, 0, len(terms)+1)
-			args = make([]interface{}, 0, len(terms)+1)
+		if opts.StarredOnly {
+			// Starred documents and the blocks within them
+			conditions = append(conditions, fmt.Sprintf("c7 IN (SELECT c7 FROM %s WHERE c3 = 'document' AND %s = 1)", tableName, b.starredColumns[space.ID]))
+		}
+
+		if opts.FolderID != "" {
+			// Documents in the folder and the blocks within them
+			conditions = append(conditions, fmt.Sprintf("c7 IN (SELECT c7 FROM %s WHERE c3 = 'document' AND %s = ?)", tableName, b.folderColumns[space.ID]))
+			args = append(args, opts.FolderID)
+		}
 
-			// Filter out empty content
-			conditions = append(conditions, "c1 IS NOT NULL AND length(c1) > 0")
+		if opts.File != "" {
+			conditions = append(conditions, fmt.Sprintf(`%s LIKE ? ESCAPE '\'`, b.attachmentColumns[space.ID]))
+			args = append(args, "%"+escapeLike(opts.File)+"%")
+		}
 
+		if len(opts.FolderPath) > 0 {
+			// The segments in the order typed, anywhere in the folder value
+			pattern := "%"
+			for _, segment := range opts.FolderPath {
+				pattern += escapeLike(segment) + "%"
+			}
+			conditions = append(conditions, fmt.Sprintf(`c7 IN (SELECT c7 FROM %s WHERE c3 = 'document' AND %s LIKE ? ESCAPE '\')`, tableName, b.folderColumns[space.ID]))
+			args = append(args, pattern)
+		}
+
+		switch opts.Todo {
+		case TodoOpen:
+			conditions = append(conditions, "c1 LIKE '%[ ]%'")
+		case TodoDone:
+			// LIKE ignores the case of ASCII letters, matching [X] as well
+			conditions = append(conditions, "c1 LIKE '%[x]%'")
+		}
+
+		switch {
+		case opts.subsequence != "":
+			// Document titles holding the characters in order
+			conditions = append(conditions, "c3 = 'document'", `c1 LIKE ? ESCAPE '\'`)
+			args = append(args, subsequencePattern(opts.subsequence))
+		case len(terms) == 0 && (opts.DocumentID != "" || opts.FolderID != "" || len(opts.FolderPath) > 0 || opts.File != "" || opts.Todo != "" || opts.regexScan):
+			// No search terms within a scope, return all of its blocks
+		case len(terms) == 0:
+			// No search terms, return recent documents only (not individual blocks)
+			conditions = append(conditions, "c3 = 'document'")
+			order = b.recentOrder(ctx, space, opts.RecentBy, opts.ModifiedColumn)
+		default:
+			if opts.BodyOnly {
+				conditions = append(conditions, "c3 != 'document'")
+			}
+			if opts.DocumentsOnly {
+				conditions = append(conditions, "c3 = 'document'")
+			}
 			for _, term := range terms {
+				if opts.RawMatch {
+					conditions = append(conditions, `c1 LIKE ? ESCAPE '\'`)
+					args = append(args, "%"+escapeLike(term)+"%")
+					continue
+				}
+				if opts.FoldDiacritics {
+					// The terms are folded already
+					conditions = append(conditions, FoldFunction+"(c1) LIKE ?")
+					args = append(args, "%"+term+"%")
+					continue
+				}
 				conditions = append(conditions, "c1 LIKE ?") // c1 contains the content
 				args = append(args, "%"+term+"%")
 			}
+		}
+
+		whereClause := strings.Join(conditions, " AND ")
+		query := fmt.Sprintf(`
+			SELECT c0 as id, c1 as content, c3 as entityType, IFNULL(c7, '') as documentId 
+			FROM %s 
+			WHERE %s 
+			%s
+			LIMIT ? OFFSET ?
+		`, tableName, whereClause, order)
+		args = append(args, limit, opts.offset)
+
+		log.Printf("Trying LIKE query on %s: %s, args: %v", tableName, query, args)
+
+		rows, err := space.DB.QueryContext(ctx, query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		log.Printf("LIKE query on %s failed: %v", tableName, err)
+		lastErr = err
+	}
+
+	// The basic search below ignores the scope, never widen a scoped search
+	if opts.DocumentID != "" || opts.StarredOnly || opts.FolderID != "" || len(opts.FolderPath) > 0 || opts.File != "" || opts.BodyOnly || opts.DocumentsOnly || opts.Todo != "" {
+		return nil, lastErr
+	}
+
+	// If both table attempts fail, try a simpler approach
+	log.Printf("All LIKE queries failed, trying basic search")
+	return space.DB.QueryContext(ctx, "SELECT c0 as id, c1 as content, c3 as entityType, IFNULL(c7, '') as documentId FROM "+b.contentTableExpr(ctx, space)+" WHERE c1 IS NOT NULL AND length(c1) > 0 ORDER BY rowid LIMIT ? OFFSET ?", limit, opts.offset)
+}
+
+// starredColumnNames are the names the search index may give the flag that
+// marks starred documents.
+var starredColumnNames = map[string]bool{
+	"isstarred":  true,
+	"starred":    true,
+	"isfavorite": true,
+	"favorite":   true,
+}
+
+// folderColumnNames are the names the search index may give the folder a
+// document is in.
+var folderColumnNames = map[string]bool{
+	"folderid":       true,
+	"folder":         true,
+	"parentfolderid": true,
+}
+
+// modifiedColumnNames are the names the search index may give the
+// modification timestamp.
+var modifiedColumnNames = map[string]bool{
+	"modified":     true,
+	"modifiedat":   true,
+	"lastmodified": true,
+	"updatedat":    true,
+	"timestamp":    true,
+}
+
+// createdColumnNames are the names the search index may give the creation
+// timestamp.
+var createdColumnNames = map[string]bool{
+	"created":      true,
+	"createdat":    true,
+	"creationdate": true,
+	"datecreated":  true,
+}
+
+// Priorities of documents over blocks.
+const (
+	DocPriorityStrict    = "strict"
+	DocPriorityRelevance = "relevance"
+)
+
+// Timestamps ordering the recent documents.
+const (
+	RecentByModified = "modified"
+	RecentByCreated  = "created"
+)
+
+// recentOrder returns the ORDER BY clause listing the recent documents of the
+// space newest first by the RecentBy timestamp. Without such a column in the
+// index, it falls back to the block ID, which grows with creation.
+func (b *BlockRepo) recentOrder(ctx context.Context, space Space, recentBy, modifiedColumn string) string {
+	names := modifiedNames(modifiedColumn)
+	if recentBy == RecentByCreated {
+		names = createdColumnNames
+	}
+
+	column, err := b.findColumn(ctx, space, names)
+	if err != nil {
+		log.Printf("Looking up the %s timestamp of %s failed: %v", recentBy, space.ID, err)
+	}
+	if column == "" {
+		return "ORDER BY c0 DESC"
+	}
+	return "ORDER BY " + column + " DESC, c0 DESC"
+}
+
+// modifiedNames returns the names of the modification timestamp column to
+// look for: the configured one, or else the known ones.
+func modifiedNames(modifiedColumn string) map[string]bool {
+	if modifiedColumn == "" {
+		return modifiedColumnNames
+	}
+	return map[string]bool{strings.ToLower(modifiedColumn): true}
+}
+
+// Orders of the search results.
+const (
+	SortByRelevance = "relevance"
+	SortByModified  = "modified"
+)
+
+// sortByModified orders the records by the modification time of their
+// documents, newest first. Records of the same time keep their relevance
+// order. When no time is known, e.g. as the index has no timestamp column,
+// the relevance order stays.
+func sortByModified(records []blockRecord) {
+	known := false
+	for _, record := range records {
+		if !record.block.ModifiedAt.IsZero() {
+			known = true
+			break
+		}
+	}
+	if !known {
+		log.Printf("No modification times in the index, keeping the relevance order")
+		return
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].block.ModifiedAt.After(records[j].block.ModifiedAt)
+	})
+}
+
+// findColumn returns the content table column that holds one of the named
+// search table columns, or "" if the index has none of them. The content
+// table names its columns c0, c1, ... in the order of the search table.
+func (b *BlockRepo) findColumn(ctx context.Context, space Space, names map[string]bool) (string, error) {
+	rows, err := space.DB.QueryContext(ctx, "PRAGMA table_info('BlockSearch')")
+	if err != nil {
+		return "", types.NewError("failed to inspect the search index", err)
+	}
+
+	column := ""
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			ctype      sql.NullString
+			notNull    int
+			dfltValue  sql.NullString
+			primaryKey int
+		)
+
+		if err = rows.Scan(&cid, &name, &ctype, &notNull, &dfltValue, &primaryKey); err != nil {
+			_ = rows.Close()
+			return "", types.NewError("failed to scan a row", err)
+		}
+
+		if names[strings.ToLower(name)] {
+			column = "c" + strconv.Itoa(cid)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", types.NewError("error in rows", err)
+	}
+
+	if err = rows.Close(); err != nil {
+		return "", types.NewError("closing rows failed", err)
+	}
+
+	return column, nil
+}
+
+// resolveStarredColumns finds the content table column holding the starred
+// flag in every space.
+func (b *BlockRepo) resolveStarredColumns(ctx context.Context, spaces []Space) error {
+	if b.starredColumns == nil {
+		b.starredColumns = make(map[string]string)
+	}
+	return b.resolveColumns(ctx, spaces, b.starredColumns, starredColumnNames, "Starred filter unavailable", "starred flag")
+}
+
+// resolveFolderColumns finds the content table column holding the folder of
+// a document in every space.
+func (b *BlockRepo) resolveFolderColumns(ctx context.Context, spaces []Space) error {
+	if b.folderColumns == nil {
+		b.folderColumns = make(map[string]string)
+	}
+	return b.resolveColumns(ctx, spaces, b.folderColumns, folderColumnNames, "Folder filter unavailable", "folder")
+}
+
+// resolveColumns finds the column with one of the names in every space and
+// records it in resolved. A space without such a column fails with title.
+func (b *BlockRepo) resolveColumns(ctx context.Context, spaces []Space, resolved map[string]string, names map[string]bool, title, what string) error {
+	for _, space := range spaces {
+		if _, ok := resolved[space.ID]; ok {
+			continue
+		}
+
+		column, err := b.findColumn(ctx, space, names)
+		if err != nil {
+			return err
+		}
+
+		if column == "" {
+			return types.NewError(title, fmt.Errorf("the search index of space %s has no %s", space.ID, what))
+		}
+
+		resolved[space.ID] = column
+	}
+
+	return nil
+}
+
+// parseTimestamp reads a timestamp stored either in seconds or milliseconds
+// since the Unix epoch.
+func parseTimestamp(value float64) time.Time {
+	if value > 1e12 {
+		return time.Unix(0, int64(value)*int64(time.Millisecond))
+	}
+	return time.Unix(int64(value), 0)
+}
+
+// iconColumnNames are the names the search index may give the icon or emoji
+// of a document.
+var iconColumnNames = map[string]bool{
+	"icon":         true,
+	"emoji":        true,
+	"documenticon": true,
+}
+
+// backfillDocumentIcons sets DocumentIcon of the blocks to the icon of their
+// documents. Spaces whose index has no icon are left as is.
+func (b *BlockRepo) backfillDocumentIcons(ctx context.Context, blocks []Block) error {
+	idsBySpace := make(map[string][]interface{})
+	for _, block := range blocks {
+		idsBySpace[block.SpaceID] = append(idsBySpace[block.SpaceID], block.DocumentID)
+	}
+
+	icons := make(map[string]string)
+	for _, space := range b.spaces {
+		ids := idsBySpace[space.ID]
+		if len(ids) == 0 {
+			continue
+		}
+
+		column, err := b.findColumn(ctx, space, iconColumnNames)
+		if err != nil {
+			return err
+		}
+		if column == "" {
+			continue
+		}
+
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = "?" + strconv.Itoa(i+1)
+		}
+
+		query := `select c7 as documentId, ` + column + ` as icon from ` + b.contentTableExpr(ctx, space) + ` where c3 = 'document' and c7 in (` + strings.Join(placeholders, ", ") + ")"
+		rows, err := space.DB.QueryContext(ctx, query, ids...)
+		if err != nil {
+			return types.NewError("failed to query document icons", err)
+		}
+
+		for rows.Next() {
+			var documentID string
+			var value sql.NullString
+
+			if err = rows.Scan(&documentID, &value); err != nil {
+				_ = rows.Close()
+				return types.NewError("failed to scan row", err)
+			}
+
+			if icon := strings.TrimSpace(value.String); value.Valid && icon != "" {
+				icons[DocumentKey(space.ID, documentID)] = icon
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return types.NewError("error in rows", err)
+		}
+
+		if err = rows.Close(); err != nil {
+			return types.NewError("closing rows failed", err)
+		}
+	}
+
+	for i, block := range blocks {
+		blocks[i].DocumentIcon = icons[DocumentKey(block.SpaceID, block.DocumentID)]
+	}
+
+	return nil
+}
+
+// backfillModifiedAt sets ModifiedAt of the blocks to the modification time
+// of their documents. Spaces whose index has no timestamp are left as is.
+func (b *BlockRepo) backfillModifiedAt(ctx context.Context, blocks []Block, modifiedColumn string) error {
+	idsBySpace := make(map[string][]interface{})
+	for _, block := range blocks {
+		idsBySpace[block.SpaceID] = append(idsBySpace[block.SpaceID], block.DocumentID)
+	}
+
+	modified := make(map[string]time.Time)
+	for _, space := range b.spaces {
+		ids := idsBySpace[space.ID]
+		if len(ids) == 0 {
+			continue
+		}
+
+		column, err := b.findColumn(ctx, space, modifiedNames(modifiedColumn))
+		if err != nil {
+			return err
+		}
+		if column == "" {
+			log.Printf("Search index of space %s has no modification time, skipping recency", space.ID)
+			continue
+		}
+
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = "?" + strconv.Itoa(i+1)
+		}
+
+		query := `select c7 as documentId, ` + column + ` as modified from ` + b.contentTableExpr(ctx, space) + ` where c3 = 'document' and c7 in (` + strings.Join(placeholders, ", ") + ")"
+		rows, err := space.DB.QueryContext(ctx, query, ids...)
+		if err != nil {
+			return types.NewError("failed to query modification times", err)
+		}
+
+		for rows.Next() {
+			var documentID string
+			var value sql.NullFloat64
+
+			if err = rows.Scan(&documentID, &value); err != nil {
+				_ = rows.Close()
+				return types.NewError("failed to scan row", err)
+			}
+
+			if value.Valid {
+				modified[DocumentKey(space.ID, documentID)] = parseTimestamp(value.Float64)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return types.NewError("error in rows", err)
+		}
+
+		if err = rows.Close(); err != nil {
+			return types.NewError("closing rows failed", err)
+		}
+	}
+
+	for i, block := range blocks {
+		blocks[i].ModifiedAt = modified[DocumentKey(block.SpaceID, block.DocumentID)]
+	}
+
+	return nil
+}
+
+// joinedMatchDocumentLimit caps the documents whose blocks are joined for a
+// single search, as every document costs a query.
+const joinedMatchDocumentLimit = 20
+
+// joinedMatches returns the documents of the candidate blocks whose title and
+// blocks, joined together, contain every query word. Documents in skip,
+// keyed by DocumentKey, are not checked.
+func (b *BlockRepo) joinedMatches(ctx context.Context, candidates []Block, q searchQuery, skip map[string]bool) ([]Block, error) {
+	var documents []Block
+	checked := make(map[string]bool)
+
+	for _, candidate := range candidates {
+		key := DocumentKey(candidate.SpaceID, candidate.DocumentID)
+		if checked[key] || skip[key] {
+			continue
+		}
+		if len(checked) >= joinedMatchDocumentLimit {
+			break
+		}
+		checked[key] = true
+
+		blocks, err := b.DocumentBlocks(ctx, candidate.SpaceID, candidate.DocumentID)
+		if err != nil {
+			return documents, err
+		}
+
+		var document *Block
+		var joined strings.Builder
+		for i, block := range blocks {
+			if block.IsDocument() {
+				document = &blocks[i]
+			}
+			joined.WriteString(strings.ToLower(block.Content))
+			joined.WriteString("\n")
+		}
+
+		if document != nil && containsAllWords(joined.String(), q.words) {
+			documents = append(documents, *document)
+		}
+	}
+
+	return documents, nil
+}
+
+// errSpaceTimeout reports that a query on a single space exceeded the
+// SpaceTimeout of the search.
+var errSpaceTimeout = errors.New("space query timed out")
+
+// queryBlocks runs searchWithLike against the space and scans the resulting
+// rows. With SpaceTimeout set, the query gets its own deadline so that a slow
+// or locked space does not hold up the others.
+func (b *BlockRepo) queryBlocks(ctx context.Context, space Space, terms []string, opts SearchOptions, limit int) ([]Block, error) {
+	start := time.Now()
+	defer func() { b.addSpaceTime(space.ID, time.Since(start)) }()
+
+	queryCtx := ctx
+	if opts.SpaceTimeout > 0 {
+		var cancel context.CancelFunc
+		queryCtx, cancel = context.WithTimeout(ctx, opts.SpaceTimeout)
+		defer cancel()
+	}
+
+	blocks, err := b.scanBlocks(queryCtx, space, terms, opts, limit)
+	if err != nil && queryCtx.Err() != nil && ctx.Err() == nil {
+		return nil, errSpaceTimeout
+	}
+
+	return blocks, err
+}
+
+func (b *BlockRepo) scanBlocks(ctx context.Context, space Space, terms []string, opts SearchOptions, limit int) ([]Block, error) {
+	rows, err := b.searchWithLike(ctx, space, terms, opts, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []Block
+	for rows.Next() {
+		block := Block{SpaceID: space.ID}
+
+		if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
+			_ = rows.Close()
+			return nil, types.NewError("failed to scan a row", err)
+		}
+		block.Content = plainContent(block.Content)
+		if !block.IsDocument() {
+			block.ReferenceID = referencedID(block.Content)
+		}
+
+		// The query only finds the markup somewhere in the content
+		if opts.Todo != "" && todoState(block.Content) != opts.Todo {
+			continue
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, types.NewError("error in rows", err)
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, types.NewError("closing rows failed", err)
+	}
+
+	return blocks, nil
+}
+
+// TimedOutSpaces returns the spaces the last Search gave up on because they
+// exceeded SpaceTimeout.
+func (b *BlockRepo) TimedOutSpaces() []string {
+	return b.timedOut
+}
+
+// spacesFor returns the spaces to search, based on AllSpaces and
+// CurrentSpaceID.
+func (b *BlockRepo) spacesFor(opts SearchOptions) ([]Space, error) {
+	var spacesToSearch []Space
+	if opts.AllSpaces {
+		spacesToSearch = b.spaces
+	} else if opts.CurrentSpaceID != "" {
+		// Only search the specified primary space
+		for _, space := range b.spaces {
+			if space.ID == opts.CurrentSpaceID {
+				spacesToSearch = []Space{space}
+				break
+			}
+		}
+		if len(spacesToSearch) == 0 {
+			log.Printf("Primary space %s not found, searching all spaces", opts.CurrentSpaceID)
+			spacesToSearch = b.spaces
+		}
+	} else {
+		spacesToSearch = b.spaces
+	}
+
+	// Searching nothing would look like a query without results, so say why
+	if len(spacesToSearch) == 0 {
+		return nil, types.NewConfigError("All spaces excluded by configuration", errors.New("no spaces left to search"))
+	}
+
+	return spacesToSearch, nil
+}
+
+// DailyNotes returns the daily notes, documents titled YYYY.MM.DD, dated from
+// from up to but excluding to, oldest first.
+func (b *BlockRepo) DailyNotes(ctx context.Context, from, to time.Time, opts SearchOptions) ([]Block, error) {
+	spacesToSearch, err := b.spacesFor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	type dailyNote struct {
+		block Block
+		date  time.Time
+	}
+
+	var notes []dailyNote
+	for _, space := range spacesToSearch {
+		rows, err := space.DB.QueryContext(ctx, `
+			SELECT c0 as id, c1 as content, c3 as entityType, IFNULL(c7, '') as documentId
+			FROM `+b.contentTableExpr(ctx, space)+`
+			WHERE c3 = 'document' AND c1 LIKE '____.__.__'
+			ORDER BY rowid
+		`)
+		if err != nil {
+			return nil, types.NewError("failed to query daily notes", err)
+		}
+
+		for rows.Next() {
+			block := Block{SpaceID: space.ID}
+
+			if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
+				_ = rows.Close()
+				return nil, types.NewError("failed to scan a row", err)
+			}
 
-			whereClause := strings.Join(conditions, " AND ")
-			query = fmt.Sprintf(`
-				SELECT c0 as id, c1 as content, c3 as entityType, c7 as documentId 
-				FROM %s 
-				WHERE %s 
-				LIMIT ?
-			`, tableName, whereClause)
-			args = append(args, limit)
+			date, ok := parseDateTitle(block.Content)
+			if !ok || date.Before(from) || !date.Before(to) {
+				continue
+			}
+			notes = append(notes, dailyNote{block: block, date: date})
 		}
 
-		log.Printf("Trying LIKE query on %s: %s, args: %v", tableName, query, args)
+		if err = rows.Err(); err != nil {
+			return nil, types.NewError("error in rows", err)
+		}
 
-		rows, err := space.DB.QueryContext(ctx, query, args...)
-		if err == nil {
-			return rows, nil
+		if err = rows.Close(); err != nil {
+			return nil, types.NewError("closing rows failed", err)
 		}
-		log.Printf("LIKE query on %s failed: %v", tableName, err)
 	}
 
-	// If both table attempts fail, try a simpler approach
-	log.Printf("All LIKE queries failed, trying basic search")
-	return space.DB.QueryContext(ctx, "SELECT c0 as id, c1 as content, c3 as entityType, c7 as documentId FROM BlockSearch_content WHERE c1 IS NOT NULL AND length(c1) > 0 LIMIT ?", limit)
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].date.Before(notes[j].date)
+	})
+
+	blocks := make([]Block, 0, len(notes))
+	for _, note := range notes {
+		blocks = append(blocks, note.block)
+	}
+
+	return blocks, nil
 }
 
-func (b *BlockRepo) Search(ctx context.Context, terms []string, allSpaces bool, daily bool, currentSpaceID string) ([]Block, error) {
+func (b *BlockRepo) Search(ctx context.Context, terms []string, opts SearchOptions) ([]Block, error) {
 	log.Printf("Searching with terms: %v", terms)
 
-	// Filter spaces based on allSpaces and currentSpaceID
-	var spacesToSearch []Space
-	if allSpaces {
-		spacesToSearch = b.spaces
-	} else if currentSpaceID != "" {
-		// Only search the specified primary space
-		for _, space := range b.spaces {
-			if space.ID == currentSpaceID {
-				spacesToSearch = []Space{space}
-				break
-			}
+	if opts.ResultLimit <= 0 {
+		opts.ResultLimit = searchResultLimit
+	}
+	if opts.FetchLimit <= 0 {
+		opts.FetchLimit = searchFetchLimit
+	}
+
+	spacesToSearch, err := b.spacesFor(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StarredOnly {
+		if err := b.resolveStarredColumns(ctx, spacesToSearch); err != nil {
+			return nil, err
 		}
-		if len(spacesToSearch) == 0 {
-			log.Printf("Primary space %s not found, searching all spaces", currentSpaceID)
-			spacesToSearch = b.spaces
+	}
+
+	if opts.FolderID != "" || len(opts.FolderPath) > 0 {
+		if err := b.resolveFolderColumns(ctx, spacesToSearch); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.File != "" {
+		if err := b.resolveAttachmentColumns(ctx, spacesToSearch); err != nil {
+			return nil, err
 		}
-	} else {
-		spacesToSearch = b.spaces
 	}
 
 	var allBlocks []Block
 	seenIDs := make(map[string]bool)
+	collect := func(blocks []Block) {
+		for _, block := range blocks {
+			key := DocumentKey(block.SpaceID, block.ID)
+			if !seenIDs[key] {
+				allBlocks = append(allBlocks, block)
+				seenIDs[key] = true
+			}
+		}
+	}
+
+	// Spaces that exceeded SpaceTimeout are skipped for the rest of the search
+	timedOut := make(map[string]bool)
+	b.timedOut = nil
+	b.timings = SearchTimings{}
+	defer func() {
+		for _, space := range spacesToSearch {
+			if timedOut[space.ID] {
+				b.timedOut = append(b.timedOut, space.ID)
+			}
+		}
+	}()
+
+	if opts.Regex != "" {
+		return b.searchRegex(ctx, spacesToSearch, opts, timedOut)
+	}
 
 	// If no search terms, show recent documents (similar to Bear workflow)
 	if len(terms) == 0 {
 		log.Printf("No search terms, showing recent documents")
 		for _, space := range spacesToSearch {
-			rows, err := b.searchWithLike(ctx, space, []string{}, searchResultLimit)
+			blocks, err := b.queryBlocks(ctx, space, []string{}, opts, opts.ResultLimit)
+			if errors.Is(err, errSpaceTimeout) {
+				log.Printf("Recent documents query on %s timed out", space.ID)
+				timedOut[space.ID] = true
+				continue
+			}
 			if err != nil {
 				log.Printf("Recent documents query failed: %v", err)
 				return nil, types.NewError("failed to query recent documents", err)
 			}
 
-			for rows.Next() {
-				block := Block{SpaceID: space.ID}
-
-				if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
-					return nil, types.NewError("failed to scan a row", err)
-				}
-
-				if !seenIDs[block.ID] {
-					allBlocks = append(allBlocks, block)
-					seenIDs[block.ID] = true
-				}
-			}
+			collect(blocks)
+		}
 
-			if err = rows.Err(); err != nil {
-				return nil, types.NewError("error in rows", err)
-			}
+		return b.filterDateTitles(allBlocks, opts.Daily, opts.ResultLimit), nil
+	}
 
-			if err = rows.Close(); err != nil {
-				return nil, types.NewError("closing rows failed", err)
-			}
+	// Folded terms match the folded content, in SQL and in scoring
+	opts.FoldDiacritics = opts.FoldDiacritics && !opts.RawMatch
+	if opts.FoldDiacritics {
+		folded := make([]string, len(terms))
+		for i, term := range terms {
+			folded[i] = FoldDiacritics(term)
 		}
-		
-		return b.filterDateTitles(allBlocks, daily), nil
+		terms = folded
+		opts.Phrase = FoldDiacritics(opts.Phrase)
 	}
 
 	// Fuzzy search implementation similar to Bear workflow
-	searchPhrase := strings.ToLower(strings.Join(terms, " "))
-	searchWords := make([]string, len(terms))
-	for i, term := range terms {
-		searchWords[i] = strings.ToLower(term)
+	query := newSearchQuery(terms)
+	if opts.RawMatch {
+		query = newRawSearchQuery(terms)
+	}
+	query.titleWeight = opts.TitleWeight
+	query.fold = opts.FoldDiacritics
+	if opts.Phrase != "" && !opts.RawMatch {
+		query.phrase = newSearchQuery(strings.Fields(opts.Phrase)).phrase
+	}
+	searchWords := query.words
+	terms = query.fetchTerms()
+
+	if opts.DisablePhrasePass && opts.DisableWordPass {
+		return nil, types.NewConfigError("No search passes", errors.New("the phrase and the word pass are both disabled"))
 	}
 
-	// First pass: search for full phrase
-	if len(terms) > 0 {
+	// First pass: search for full phrase. For a single word, it is the word
+	// pass too, so it always runs.
+	firstPassCounts := make(map[string]int, len(spacesToSearch))
+	if len(terms) == 1 || (len(terms) > 1 && !opts.DisablePhrasePass) {
 		for _, space := range spacesToSearch {
-			log.Printf("Searching %s for full phrase, limit %d", space.ID, searchFetchLimit)
+			log.Printf("Searching %s for full phrase, limit %d", space.ID, opts.FetchLimit)
 
-			rows, err := b.searchWithLike(ctx, space, terms, searchFetchLimit)
+			blocks, err := b.queryBlocks(ctx, space, terms, opts, opts.FetchLimit)
+			if errors.Is(err, errSpaceTimeout) {
+				log.Printf("LIKE search on %s timed out", space.ID)
+				timedOut[space.ID] = true
+				continue
+			}
 			if err != nil {
 				log.Printf("LIKE search failed: %v", err)
 				return nil, types.NewError("failed to query database search", err)
 			}
 
-			for rows.Next() {
-				block := Block{SpaceID: space.ID}
+			collect(blocks)
+			firstPassCounts[space.ID] = len(blocks)
+		}
+	}
 
-				if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
-					return nil, types.NewError("failed to scan a row", err)
+	// Second pass: search for individual words (for fuzzy matching)
+	if len(terms) > 1 && !opts.DisableWordPass {
+		// Longer words narrow the candidates most, run them before the cap
+		wordTerms := append([]string(nil), terms...)
+		sort.SliceStable(wordTerms, func(i, j int) bool {
+			return utf8.RuneCountInString(wordTerms[i]) > utf8.RuneCountInString(wordTerms[j])
+		})
+
+		passes, skipped := 0, 0
+		for _, term := range wordTerms {
+			for _, space := range spacesToSearch {
+				if timedOut[space.ID] {
+					continue
 				}
 
-				if !seenIDs[block.ID] {
-					allBlocks = append(allBlocks, block)
-					seenIDs[block.ID] = true
+				// Common words already filled the first pass, broadening
+				// would only add noise
+				if opts.WordPassThreshold > 0 && firstPassCounts[space.ID] >= opts.WordPassThreshold {
+					continue
 				}
-			}
-
-			if err = rows.Err(); err != nil {
-				return nil, types.NewError("error in rows", err)
-			}
 
-			if err = rows.Close(); err != nil {
-				return nil, types.NewError("closing rows failed", err)
-			}
-		}
-	}
+				if opts.MaxWordPasses > 0 && passes >= opts.MaxWordPasses {
+					skipped++
+					continue
+				}
+				passes++
 
-	// Second pass: search for individual words (for fuzzy matching)
-	if len(terms) > 1 {
-		for _, term := range terms {
-			for _, space := range spacesToSearch {
 				log.Printf("Searching %s for individual word %q", space.ID, term)
 
-				rows, err := b.searchWithLike(ctx, space, []string{term}, searchFetchLimit)
+				blocks, err := b.queryBlocks(ctx, space, []string{term}, opts, opts.FetchLimit)
+				if errors.Is(err, errSpaceTimeout) {
+					log.Printf("LIKE search for word on %s timed out", space.ID)
+					timedOut[space.ID] = true
+					continue
+				}
 				if err != nil {
 					log.Printf("LIKE search for word failed: %v", err)
 					continue
 				}
 
-				for rows.Next() {
-					block := Block{SpaceID: space.ID}
+				collect(blocks)
+			}
+		}
+
+		if skipped > 0 {
+			log.Printf("Word pass capped at %d queries, skipped %d", opts.MaxWordPasses, skipped)
+		}
+	}
 
-					if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
-						return nil, types.NewError("failed to scan a row", err)
-					}
+	// Subsequence pass: titles holding the query characters in order, which
+	// includes the titles whose initials are the query
+	if pattern := strings.Join(searchWords, ""); (opts.Subsequence || opts.Acronym) && !opts.BodyOnly && pattern != "" {
+		subsequenceOpts := opts
+		subsequenceOpts.subsequence = pattern
 
-					if !seenIDs[block.ID] {
-						allBlocks = append(allBlocks, block)
-						seenIDs[block.ID] = true
-					}
-				}
+		for _, space := range spacesToSearch {
+			if timedOut[space.ID] {
+				continue
+			}
 
-				if err = rows.Err(); err != nil {
-					return nil, types.NewError("error in rows", err)
-				}
+			log.Printf("Searching %s for subsequence %q", space.ID, pattern)
 
-				if err = rows.Close(); err != nil {
-					return nil, types.NewError("closing rows failed", err)
-				}
+			blocks, err := b.queryBlocks(ctx, space, nil, subsequenceOpts, opts.FetchLimit)
+			if errors.Is(err, errSpaceTimeout) {
+				log.Printf("Subsequence search on %s timed out", space.ID)
+				timedOut[space.ID] = true
+				continue
 			}
+			if err != nil {
+				log.Printf("Subsequence search failed: %v", err)
+				continue
+			}
+
+			collect(blocks)
+		}
+	}
+
+	if opts.RecencyWeight > 0 || opts.SortBy == SortByModified {
+		if err := b.backfillModifiedAt(ctx, allBlocks, opts.ModifiedColumn); err != nil {
+			log.Printf("Reading modification times failed, skipping recency: %v", err)
 		}
 	}
 
 	// Score and rank all blocks
+	scoringStart := time.Now()
+	defer func() { b.timings.Scoring = time.Since(scoringStart) }()
+	now := time.Now()
+	minMatchRatio := opts.MatchRatio
+	if minMatchRatio <= 0 || minMatchRatio > 1 {
+		minMatchRatio = 1
+	}
+	if query.titleWeight > 0 && len(searchWords) > 0 {
+		// Blocks weigh the words in the title of their document too
+		titles, err := b.DocumentTitles(ctx, allBlocks)
+		if err != nil {
+			log.Printf("Reading document titles failed, weighing content only: %v", err)
+		}
+		for i, block := range allBlocks {
+			if !block.IsDocument() {
+				allBlocks[i].DocumentTitle = titles[DocumentKey(block.SpaceID, block.DocumentID)]
+			}
+		}
+	}
 	records := make([]blockRecord, 0, len(allBlocks))
 	for i, block := range allBlocks {
-		record := scoreBlock(block, searchPhrase, searchWords, i)
-		
-		// Only include blocks that match all words (for multi-word searches)
+		record := scoreBlock(block, query, i)
+		if opts.RecencyWeight > 0 && !block.ModifiedAt.IsZero() {
+			record.recencyPenalty = opts.RecencyWeight * now.Sub(block.ModifiedAt).Hours() / (24 * 365)
+		}
+
+		// Tagged searches need the tag at least mentioned in the content
+		if len(query.tags) > 0 && !containsAllWords(strings.ToLower(block.Content), query.tags) {
+			continue
+		}
+
+		if opts.NumericBoundary {
+			record.numbersStandalone = true
+			lowerContent := strings.ToLower(block.Content)
+			for _, word := range searchWords {
+				if isDigits(word) && !containsStandaloneNumber(lowerContent, word) {
+					record.numbersStandalone = false
+					break
+				}
+			}
+			record.block.Match.StandaloneNumbers = record.numbersStandalone
+		}
+
+		if opts.Acronym && record.isDocument && !record.allWordsMatch {
+			record.acronymMatch = acronymMatch(strings.ToLower(block.Content), strings.ToLower(strings.Join(searchWords, "")))
+			record.block.Match.Acronym = record.acronymMatch
+		}
+
+		// Without SUBSEQUENCE, titles fetched for acronyms need to be one
+		if opts.Acronym && !opts.Subsequence && record.isDocument && !record.exactMatch && !record.allWordsMatch && !record.acronymMatch {
+			continue
+		}
+
+		if opts.Subsequence && record.isDocument && !record.allWordsMatch {
+			record.subsequenceScore = subsequenceScore(strings.ToLower(block.Content), strings.Join(searchWords, ""))
+			record.block.Match.Subsequence = record.subsequenceScore > 0
+		}
+
+		// Only include blocks that match enough words (for multi-word searches)
 		if len(searchWords) > 1 {
-			if record.allWordsMatch {
+			matched := float64(len(record.block.Match.MatchedWords)) / float64(len(searchWords))
+			if record.allWordsMatch || record.acronymMatch || record.subsequenceScore > 0 || matched >= minMatchRatio {
 				records = append(records, record)
 			}
 		} else {
@@ -363,11 +1609,67 @@ func (b *BlockRepo) Search(ctx context.Context, terms []string, allSpaces bool,
 		}
 	}
 
+	// Documents whose words are spread over several blocks rank below the
+	// blocks matching all words on their own
+	if opts.JoinedMatch && !opts.BodyOnly && len(searchWords) > 1 {
+		included := make(map[string]bool, len(records))
+		for _, record := range records {
+			included[DocumentKey(record.block.SpaceID, record.block.ID)] = true
+		}
+
+		documents, err := b.joinedMatches(ctx, allBlocks, query, included)
+		if err != nil {
+			log.Printf("Joined match failed: %v", err)
+		}
+
+		for _, document := range documents {
+			record := scoreBlock(document, query, len(allBlocks)+len(records))
+			record.block.Match.JoinedMatch = true
+			records = append(records, record)
+		}
+	}
+
+	scorer := b.scorer
+	if scorer == nil {
+		scorer = MatchTiers{}
+	}
+	scoreQuery := ScoreQuery{Phrase: query.phrase, Words: query.words, Tags: query.tags}
+	for i := range records {
+		records[i].score = scorer.Score(records[i].block, scoreQuery)
+	}
+
 	// Sort by match quality (similar to Bear workflow)
 	sort.SliceStable(records, func(i, j int) bool {
 		iRecord := records[i]
 		jRecord := records[j]
 
+		// Strict priority puts every document above every block
+		if opts.DocPriority == DocPriorityStrict && iRecord.isDocument != jRecord.isDocument {
+			return iRecord.isDocument
+		}
+
+		if iRecord.score != jRecord.score {
+			return iRecord.score > jRecord.score
+		}
+
+		// Typing a title exactly makes that title the top result
+		if iRecord.equalMatch != jRecord.equalMatch {
+			return iRecord.equalMatch
+		}
+		if iRecord.equalMatch && iRecord.isDocument != jRecord.isDocument {
+			return iRecord.isDocument
+		}
+
+		// A number standing on its own beats one embedded in a longer number
+		if iRecord.numbersStandalone != jRecord.numbersStandalone {
+			return iRecord.numbersStandalone
+		}
+
+		// Blocks carrying the queried tags outrank plain mentions
+		if iRecord.tagMatch != jRecord.tagMatch {
+			return iRecord.tagMatch
+		}
+
 		// Prioritize documents over blocks when match quality is equal
 		if iRecord.exactMatch != jRecord.exactMatch {
 			return iRecord.exactMatch
@@ -379,6 +1681,10 @@ func (b *BlockRepo) Search(ctx context.Context, terms []string, allSpaces bool,
 		if iRecord.orderedWordsMatch != jRecord.orderedWordsMatch {
 			return iRecord.orderedWordsMatch
 		}
+		// Words in order close together beat the same words far apart
+		if iRecord.orderedWordsMatch && iRecord.adjacency != jRecord.adjacency {
+			return iRecord.adjacency > jRecord.adjacency
+		}
 		if iRecord.orderedWordsMatch && iRecord.isDocument != jRecord.isDocument {
 			return iRecord.isDocument
 		}
@@ -390,57 +1696,251 @@ func (b *BlockRepo) Search(ctx context.Context, terms []string, allSpaces bool,
 			return iRecord.isDocument
 		}
 
+		// Acronyms of titles rank below every substring tier
+		if iRecord.acronymMatch != jRecord.acronymMatch {
+			return iRecord.acronymMatch
+		}
+
+		// Subsequence matches are a fallback below the substring tiers
+		if iRecord.subsequenceScore != jRecord.subsequenceScore {
+			return iRecord.subsequenceScore > jRecord.subsequenceScore
+		}
+
+		// Words matched in a title outweigh words matched in content
+		if iRecord.wordScore != jRecord.wordScore {
+			return iRecord.wordScore > jRecord.wordScore
+		}
+
+		// Words matched near the start weigh more than ones at the end
+		if opts.EarlyMatch && iRecord.firstMatch != jRecord.firstMatch {
+			return iRecord.firstMatch < jRecord.firstMatch
+		}
+
 		// If match quality is equal, prioritize documents
 		if iRecord.isDocument != jRecord.isDocument {
 			return iRecord.isDocument
 		}
 
+		// A bare reference carries no text of its own, blocks that do lead
+		if iReference, jReference := iRecord.block.ReferenceID != "", jRecord.block.ReferenceID != ""; iReference != jReference {
+			return jReference
+		}
+
+		// Across spaces, the primary space leads
+		if iPrimary, jPrimary := iRecord.block.SpaceID == opts.PrimarySpaceID, jRecord.block.SpaceID == opts.PrimarySpaceID; iPrimary != jPrimary {
+			return iPrimary
+		}
+
+		// Older documents sink when RecencyWeight is set
+		if iRecord.recencyPenalty != jRecord.recencyPenalty {
+			return iRecord.recencyPenalty < jRecord.recencyPenalty
+		}
+
 		// Fall back to original order (which is based on modification date from DB)
 		return iRecord.originalIndex < jRecord.originalIndex
 	})
 
+	if opts.SortBy == SortByModified {
+		sortByModified(records)
+	}
+
 	// Convert back to blocks
 	rankedBlocks := make([]Block, 0, len(records))
 	for _, record := range records {
 		rankedBlocks = append(rankedBlocks, record.block)
 	}
 
-	return b.filterDateTitles(rankedBlocks, daily), nil
+	return b.filterDateTitles(rankedBlocks, opts.Daily, opts.ResultLimit), nil
 }
 
-type docKey struct {
-	spaceID string
-	docID   string
+// space returns the space with the given ID.
+func (b *BlockRepo) space(id string) (Space, bool) {
+	for _, space := range b.spaces {
+		if space.ID == id {
+			return space, true
+		}
+	}
+	return Space{}, false
 }
 
-func (b *BlockRepo) BackfillDocumentNames(ctx context.Context, blocks []Block, targetSpaceIDs map[string]struct{}) ([]Block, error) {
-	if len(blocks) == 0 {
-		return blocks, nil
+// documentBlocksLimit caps the blocks read from a single document.
+const documentBlocksLimit = 5000
+
+// DocumentBlocks returns the blocks of a document, the document row included,
+// in their stored order. Very large documents are cut at documentBlocksLimit.
+func (b *BlockRepo) DocumentBlocks(ctx context.Context, spaceID, documentID string) ([]Block, error) {
+	space, ok := b.space(spaceID)
+	if !ok {
+		return nil, types.NewError("unknown space", fmt.Errorf("space %s not found", spaceID))
+	}
+
+	rows, err := space.DB.QueryContext(ctx, `
+		SELECT c0 as id, c1 as content, c3 as entityType, c7 as documentId
+		FROM `+b.contentTableExpr(ctx, space)+`
+		WHERE c7 = ? AND c1 IS NOT NULL AND length(c1) > 0
+		ORDER BY rowid
+		LIMIT ?
+	`, documentID, documentBlocksLimit)
+	if err != nil {
+		return nil, types.NewError("failed to query document blocks", err)
+	}
+
+	var blocks []Block
+	for rows.Next() {
+		block := Block{SpaceID: space.ID}
+
+		if err = rows.Scan(&block.ID, &block.Content, &block.EntityType, &block.DocumentID); err != nil {
+			_ = rows.Close()
+			return nil, types.NewError("failed to scan a row", err)
+		}
+		block.Content = plainContent(block.Content)
+
+		blocks = append(blocks, block)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, types.NewError("error in rows", err)
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, types.NewError("closing rows failed", err)
+	}
+
+	return blocks, nil
+}
+
+// SurroundingBlocks returns the blocks of the block's document that lie within
+// window positions before and after it, including the block itself. Blocks are
+// ordered by their position in the search index.
+func (b *BlockRepo) SurroundingBlocks(ctx context.Context, block Block, window int) ([]Block, error) {
+	documentBlocks, err := b.DocumentBlocks(ctx, block.SpaceID, block.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []Block
+	position := -1
+	for _, sibling := range documentBlocks {
+		if sibling.IsDocument() {
+			continue
+		}
+		if sibling.ID == block.ID {
+			position = len(blocks)
+		}
+		blocks = append(blocks, sibling)
+	}
+
+	if position == -1 {
+		return []Block{block}, nil
+	}
+
+	start, end := position-window, position+window+1
+	if start < 0 {
+		start = 0
+	}
+	if end > len(blocks) {
+		end = len(blocks)
+	}
+
+	return blocks[start:end], nil
+}
+
+// BackfillHeadings sets HeadingContext of the blocks to the nearest heading
+// preceding them in their document. It reads every document once.
+func (b *BlockRepo) BackfillHeadings(ctx context.Context, blocks []Block) error {
+	headings := make(map[string]string)
+	read := make(map[string]bool)
+	for _, block := range blocks {
+		key := DocumentKey(block.SpaceID, block.DocumentID)
+		if block.IsDocument() || read[key] {
+			continue
+		}
+		read[key] = true
+
+		documentBlocks, err := b.DocumentBlocks(ctx, block.SpaceID, block.DocumentID)
+		if err != nil {
+			return err
+		}
+
+		heading := ""
+		for _, sibling := range documentBlocks {
+			if sibling.IsDocument() {
+				continue
+			}
+			if sibling.IsHeading() {
+				// A heading is not under itself, but under the one before
+				headings[DocumentKey(block.SpaceID, sibling.ID)] = heading
+				heading = strings.TrimSpace(strings.TrimLeft(sibling.Content, "#"))
+				continue
+			}
+			headings[DocumentKey(block.SpaceID, sibling.ID)] = heading
+		}
+	}
+
+	for i, block := range blocks {
+		if !block.IsDocument() {
+			blocks[i].HeadingContext = headings[DocumentKey(block.SpaceID, block.ID)]
+		}
 	}
 
+	return nil
+}
+
+// DocumentKey identifies a document within a space. It is used as the key of
+// the title maps returned by DocumentTitles.
+func DocumentKey(spaceID, documentID string) string {
+	return spaceID + "/" + documentID
+}
+
+// WithDocumentTitles makes DocumentTitles take the titles of the given
+// documents, keyed by DocumentKey, without querying the index.
+func (b *BlockRepo) WithDocumentTitles(titles map[string]string) *BlockRepo {
+	b.knownTitles = titles
+	return b
+}
+
+// DocumentTitles resolves the titles of the documents the given blocks belong
+// to. Documents carry their own title, so only blocks hit the database, and
+// only when their document title is not set or known ahead.
+func (b *BlockRepo) DocumentTitles(ctx context.Context, blocks []Block) (map[string]string, error) {
+	titles := make(map[string]string)
+
 	blocksBySpace := make(map[string][]Block)
 	for _, block := range blocks {
+		key := DocumentKey(block.SpaceID, block.DocumentID)
+		if block.IsDocument() {
+			titles[key] = block.Content
+			continue
+		}
+		if block.DocumentTitle != "" {
+			titles[key] = block.DocumentTitle
+			continue
+		}
+		if title, ok := b.knownTitles[key]; ok {
+			titles[key] = title
+			continue
+		}
+		if block.DocumentID == "" || block.DocumentID == block.ID {
+			// Orphan blocks have no document to look up
+			continue
+		}
 		blocksBySpace[block.SpaceID] = append(blocksBySpace[block.SpaceID], block)
 	}
 
-	docIDs := make(map[docKey]string)
-
 	for _, space := range b.spaces {
-		b := blocksBySpace[space.ID]
+		spaceBlocks := blocksBySpace[space.ID]
+		if len(spaceBlocks) == 0 {
+			continue
+		}
 
-		ids := make([]interface{}, 0, len(b))
+		ids := make([]interface{}, 0, len(spaceBlocks))
 		placeholders := make([]string, 0, len(ids))
-		for _, k := range b {
-			if k.IsDocument() {
-				// This is a document, no need to fetch title.
-				continue
-			}
+		for _, k := range spaceBlocks {
 			ids = append(ids, k.DocumentID)
 			placeholders = append(placeholders, "?"+strconv.Itoa(len(ids)))
 		}
 
-		// Use BlockSearch_content table directly (no FTS5)
-		query := `select c7 as documentId, c1 as content from BlockSearch_content where c3 = 'document' and c7 in (` + strings.Join(placeholders, ", ") + ")"
+		query := `select c7 as documentId, c1 as content from ` + b.contentTableExpr(ctx, space) + ` where c3 = 'document' and c7 in (` + strings.Join(placeholders, ", ") + ")"
 		rows, err := space.DB.QueryContext(ctx, query, ids...)
 		if err != nil {
 			return nil, types.NewError("failed to query the database", err)
@@ -453,7 +1953,7 @@ func (b *BlockRepo) BackfillDocumentNames(ctx context.Context, blocks []Block, t
 				return nil, types.NewError("failed to scan row", err)
 			}
 
-			docIDs[docKey{spaceID: space.ID, docID: block.DocumentID}] = block.Content
+			titles[DocumentKey(space.ID, block.DocumentID)] = block.Content
 		}
 
 		if err = rows.Err(); err != nil {
@@ -465,15 +1965,46 @@ func (b *BlockRepo) BackfillDocumentNames(ctx context.Context, blocks []Block, t
 		}
 	}
 
+	return titles, nil
+}
+
+func (b *BlockRepo) BackfillDocumentNames(ctx context.Context, blocks []Block, targetSpaceIDs map[string]struct{}) ([]Block, error) {
+	if len(blocks) == 0 {
+		return blocks, nil
+	}
+
+	titles, err := b.DocumentTitles(ctx, blocks)
+	if err != nil {
+		return nil, err
+	}
+
 	// Avoid mutating data in original slice.
 	backfilled := make([]Block, len(blocks))
 	copy(backfilled, blocks)
 
+	if err := b.backfillDocumentIcons(ctx, backfilled); err != nil {
+		log.Printf("Reading document icons failed, skipping them: %v", err)
+	}
+
+	if err := b.backfillReferences(ctx, backfilled); err != nil {
+		log.Printf("Resolving linked references failed, showing them raw: %v", err)
+	}
+
+	if err := b.backfillAttachments(ctx, backfilled); err != nil {
+		log.Printf("Reading attachment names failed, skipping them: %v", err)
+	}
+
 	for i, block := range backfilled {
-		if block.IsDocument() {
+		backfilled[i].DocumentTitle = titles[DocumentKey(block.SpaceID, block.DocumentID)]
+		switch {
+		case block.IsDocument():
 			backfilled[i].DocumentName = "[Document]"
-		} else {
-			backfilled[i].DocumentName = "[Block] " + docIDs[docKey{spaceID: block.SpaceID, docID: block.DocumentID}]
+		case block.DocumentID == "" || block.DocumentID == block.ID:
+			// A block without a parent, or claiming to be its own
+			backfilled[i].DocumentTitle = ""
+			backfilled[i].DocumentName = "[Block] (orphan)"
+		default:
+			backfilled[i].DocumentName = "[Block] " + backfilled[i].DocumentTitle
 		}
 	}
 
@@ -0,0 +1,1726 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testColumns are the columns of the BlockSearch fixture table. Its content
+// table names them c0, c1, ... in this order, as Craft's index does.
+var testColumns = []string{
+	"id", "content", "type", "entityType", "customRank", "isTodo", "isTodoChecked", "documentId",
+	"isStarred", "folderId", "modified", "created", "icon", "fileName",
+}
+
+// testRow is a row of the BlockSearch fixture table.
+type testRow struct {
+	ID         string
+	Content    string
+	EntityType string
+	DocumentID string
+	Starred    bool
+	FolderID   string
+	Modified   float64
+	Created    float64
+	Icon       string
+	FileName   string
+}
+
+// document returns the row of a document, which is its own document.
+func document(id, title string) testRow {
+	return testRow{ID: id, Content: title, EntityType: "document", DocumentID: id}
+}
+
+// block returns the row of a text block of the document.
+func block(id, content, documentID string) testRow {
+	return testRow{ID: id, Content: content, EntityType: "text", DocumentID: documentID}
+}
+
+// newTestSpace creates a search index holding the rows in a temporary
+// directory and returns it as a space.
+func newTestSpace(t *testing.T, id string, rows ...testRow) Space {
+	t.Helper()
+	return newDriverSpace(t, "sqlite3", id, rows...)
+}
+
+// newDriverSpace is newTestSpace opening the index with the sql driver.
+func newDriverSpace(t *testing.T, driverName, id string, rows ...testRow) Space {
+	t.Helper()
+
+	db, err := sql.Open(driverName, filepath.Join(t.TempDir(), id+".sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec("CREATE VIRTUAL TABLE BlockSearch USING fts5(" + strings.Join(testColumns, ", ") + ")"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for _, row := range rows {
+		starred := 0
+		if row.Starred {
+			starred = 1
+		}
+		_, err = db.Exec(
+			"INSERT INTO BlockSearch VALUES (?, ?, '', ?, 0, 0, 0, ?, ?, ?, ?, ?, ?, ?)",
+			row.ID, row.Content, row.EntityType, row.DocumentID, starred, row.FolderID, row.Modified, row.Created, row.Icon, row.FileName,
+		)
+		if err != nil {
+			t.Fatalf("insert %s: %v", row.ID, err)
+		}
+	}
+
+	return Space{ID: id, DB: db}
+}
+
+func TestDocumentTitlesKnownAhead(t *testing.T) {
+	space := newTestSpace(t, "s1",
+		document("doc1", "Plan"),
+		block("b1", "step one", "doc1"),
+		block("b2", "step two", "doc2"),
+	)
+	repo := NewBlockRepo(space).WithDocumentTitles(map[string]string{
+		DocumentKey("s1", "doc2"): "Warmed",
+	})
+
+	titles, err := repo.DocumentTitles(context.Background(), []Block{
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "b2", DocumentID: "doc2", SpaceID: "s1"},
+	})
+	if err != nil {
+		t.Fatalf("DocumentTitles() error = %v", err)
+	}
+
+	if got := titles[DocumentKey("s1", "doc1")]; got != "Plan" {
+		t.Errorf("title of doc1 = %q, want it read from the index", got)
+	}
+	if got := titles[DocumentKey("s1", "doc2")]; got != "Warmed" {
+		t.Errorf("title of doc2 = %q, want the known title", got)
+	}
+}
+
+// keys returns the DocumentKey of every block, in order.
+func keys(blocks []Block) []string {
+	keys := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		keys = append(keys, DocumentKey(block.SpaceID, block.ID))
+	}
+	return keys
+}
+
+func TestNewSearchQueryTags(t *testing.T) {
+	q := newSearchQuery([]string{"#Project", "Plan", "#", "road"})
+
+	if want := []string{"project"}; !equalStrings(q.tags, want) {
+		t.Errorf("tags = %q, want %q", q.tags, want)
+	}
+	if want := []string{"plan", "#", "road"}; !equalStrings(q.words, want) {
+		t.Errorf("words = %q, want %q", q.words, want)
+	}
+	if want := "plan # road"; q.phrase != want {
+		t.Errorf("phrase = %q, want %q, without the tag", q.phrase, want)
+	}
+}
+
+func TestContainsTag(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"#project", true},
+		{"see #project.", true},
+		{"#projects", false},
+		{"#project-x", false},
+		{"project", false},
+		{"#projectx #project", true},
+	}
+
+	for _, tt := range tests {
+		if got := containsTag(tt.text, "project"); got != tt.want {
+			t.Errorf("containsTag(%q) = %t, want %t", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchRanksTaggedBlocks(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Notes"),
+		block("mention", "the project is late", "doc1"),
+		block("tagged", "kickoff #project", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"#project"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if want := []string{DocumentKey("s1", "tagged"), DocumentKey("s1", "mention")}; !equalStrings(keys(blocks), want) {
+		t.Fatalf("Search() = %v, want %v", keys(blocks), want)
+	}
+	if !blocks[0].Match.TagMatch || blocks[1].Match.TagMatch {
+		t.Errorf("TagMatch = %t, %t, want only the tagged block", blocks[0].Match.TagMatch, blocks[1].Match.TagMatch)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSurroundingBlocks(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Plan"),
+		block("b1", "one", "doc1"),
+		block("b2", "two", "doc1"),
+		block("b3", "three", "doc1"),
+		block("b4", "four", "doc1"),
+		block("b5", "five", "doc1"),
+		block("other", "elsewhere", "doc2"),
+	))
+
+	tests := []struct {
+		name   string
+		id     string
+		window int
+		want   []string
+	}{
+		{name: "middle", id: "b3", window: 1, want: []string{"b2", "b3", "b4"}},
+		{name: "start", id: "b1", window: 2, want: []string{"b1", "b2", "b3"}},
+		{name: "end", id: "b5", window: 1, want: []string{"b4", "b5"}},
+		{name: "wider than the document", id: "b2", window: 10, want: []string{"b1", "b2", "b3", "b4", "b5"}},
+		{name: "no window", id: "b2", window: 0, want: []string{"b2"}},
+		{name: "unknown block", id: "gone", window: 1, want: []string{"gone"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.SurroundingBlocks(context.Background(), Block{ID: tt.id, SpaceID: "s1", DocumentID: "doc1"}, tt.window)
+			if err != nil {
+				t.Fatalf("SurroundingBlocks() error = %v", err)
+			}
+
+			got := make([]string, 0, len(blocks))
+			for _, block := range blocks {
+				got = append(got, block.ID)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("SurroundingBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSurroundingBlocksUnknownSpace(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1"))
+
+	if _, err := repo.SurroundingBlocks(context.Background(), Block{ID: "b1", SpaceID: "s2", DocumentID: "doc1"}, 1); err == nil {
+		t.Error("SurroundingBlocks() in an unknown space succeeded")
+	}
+}
+
+func TestSearchWithoutTermsBrowsesScope(t *testing.T) {
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1", document("doc1", "Home"), block("b1", "home block", "doc1")),
+		newTestSpace(t, "s2", document("doc2", "Work"), block("b2", "work block", "doc2")),
+	)
+
+	blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s2"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if want := []string{DocumentKey("s2", "doc2")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() = %v, want the documents of the scope %v", keys(blocks), want)
+	}
+}
+
+func TestSearchWithinDocument(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Plan"),
+		block("b1", "road map", "doc1"),
+		block("b2", "road works", "doc1"),
+		block("b3", "unrelated", "doc1"),
+		block("b4", "road trip", "doc2"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1", DocumentID: "doc1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, block := range blocks {
+		got[block.ID] = true
+	}
+	if len(got) != 2 || !got["b1"] || !got["b2"] {
+		t.Errorf("Search() within doc1 = %v, want exactly b1 and b2", keys(blocks))
+	}
+}
+
+// blockingDriver is a database driver whose queries block until their context
+// is done, like a space locked by Craft.
+type blockingDriver struct{}
+
+func (blockingDriver) Open(string) (driver.Conn, error) { return blockingConn{}, nil }
+
+type blockingConn struct{}
+
+func (blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (blockingConn) Close() error              { return nil }
+func (blockingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	sql.Register("blocking", blockingDriver{})
+}
+
+func TestSearchSpaceTimeout(t *testing.T) {
+	slow, err := sql.Open("blocking", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = slow.Close() })
+
+	repo := NewBlockRepo(
+		newTestSpace(t, "fast", document("doc1", "Roadmap")),
+		Space{ID: "slow", DB: slow},
+	)
+
+	start := time.Now()
+	blocks, err := repo.Search(context.Background(), []string{"roadmap"}, SearchOptions{AllSpaces: true, SpaceTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Search() took %v, the slow space held it up", elapsed)
+	}
+
+	if want := []string{DocumentKey("fast", "doc1")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() = %v, want the results of the fast space %v", keys(blocks), want)
+	}
+	if got := repo.TimedOutSpaces(); !equalStrings(got, []string{"slow"}) {
+		t.Errorf("TimedOutSpaces() = %v, want [slow]", got)
+	}
+}
+
+// newBareSpace creates an empty search index with only the given columns, for
+// indexes of Craft versions lacking some of them.
+func newBareSpace(t *testing.T, id string, columns ...string) Space {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), id+".sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec("CREATE VIRTUAL TABLE BlockSearch USING fts5(" + strings.Join(columns, ", ") + ")"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return Space{ID: id, DB: db}
+}
+
+func TestSearchStarredOnly(t *testing.T) {
+	starred := document("doc1", "Plan A")
+	starred.Starred = true
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		starred,
+		block("b1", "plan details", "doc1"),
+		document("doc2", "Plan B"),
+		block("b2", "plan notes", "doc2"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", StarredOnly: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if want := []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() = %v, want the starred document and its block %v", keys(blocks), want)
+	}
+}
+
+func TestSearchStarredOnlyUnavailable(t *testing.T) {
+	repo := NewBlockRepo(newBareSpace(t, "s1", "id", "content", "type", "entityType", "customRank", "isTodo", "isTodoChecked", "documentId"))
+
+	_, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", StarredOnly: true})
+
+	var te types.Error
+	if !errors.As(err, &te) || te.Title != "Starred filter unavailable" {
+		t.Errorf("Search() error = %v, want the starred filter reported unavailable", err)
+	}
+}
+
+func TestScoreBlockEqualMatch(t *testing.T) {
+	q := newSearchQuery([]string{"Project", "Plan"})
+
+	tests := []struct {
+		content    string
+		equal      bool
+		exactMatch bool
+	}{
+		{"Project Plan", true, true},
+		{" project plan ", true, true},
+		{"Project Plan Archive", false, true},
+		{"The project plan", false, true},
+		{"Plan the project", false, false},
+	}
+
+	for _, tt := range tests {
+		record := scoreBlock(Block{Content: tt.content, EntityType: "document"}, q, 0)
+		if record.block.Match.EqualMatch != tt.equal || record.block.Match.ExactMatch != tt.exactMatch {
+			t.Errorf("scoreBlock(%q) equal = %t, exact = %t, want %t, %t", tt.content, record.block.Match.EqualMatch, record.block.Match.ExactMatch, tt.equal, tt.exactMatch)
+		}
+	}
+}
+
+func TestSearchRanksEqualTitleFirst(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("archive", "Project Plan Archive"),
+		block("b1", "project plan", "archive"),
+		document("plan", "Project Plan"),
+		block("b2", "the project plan is due", "plan"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"project", "plan"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	// Equality outranks containment, for blocks too
+	want := []string{DocumentKey("s1", "plan"), DocumentKey("s1", "b1")}
+	if got := keys(blocks); len(got) < 2 || !equalStrings(got[:2], want) {
+		t.Errorf("Search() = %v, want the results equal to the query first %v", got, want)
+	}
+}
+
+func TestSearchRawMatchMarkdown(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Snippets"),
+		block("fence", "```python\nprint('hi')\n```", "doc1"),
+		block("snake", "python is a snake", "doc1"),
+		block("open", "- [ ] buy milk", "doc1"),
+		block("done", "- [x] buy bread", "doc1"),
+		block("percent", "100% done", "doc1"),
+	))
+
+	tests := []struct {
+		name string
+		term string
+		want []string
+	}{
+		{name: "code fence", term: "```python", want: []string{DocumentKey("s1", "fence")}},
+		{name: "checkbox marker", term: "- [ ]", want: []string{DocumentKey("s1", "open")}},
+		{name: "like wildcard", term: "0%", want: []string{DocumentKey("s1", "percent")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{tt.term}, SearchOptions{CurrentSpaceID: "s1", RawMatch: true})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.term, keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRecencyWeight(t *testing.T) {
+	now := time.Now()
+	old := document("old", "Plan old")
+	old.Modified = float64(now.AddDate(-3, 0, 0).Unix())
+	recent := document("new", "Plan new")
+	recent.Modified = float64(now.Unix())
+	repo := NewBlockRepo(newTestSpace(t, "s1", old, recent))
+
+	tests := []struct {
+		name   string
+		weight float64
+		want   []string
+	}{
+		{name: "off keeps the index order", weight: 0, want: []string{DocumentKey("s1", "old"), DocumentKey("s1", "new")}},
+		{name: "on ranks the newer first", weight: 1, want: []string{DocumentKey("s1", "new"), DocumentKey("s1", "old")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", RecencyWeight: tt.weight})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreBlockTitleWeight(t *testing.T) {
+	q := newSearchQuery([]string{"budget", "review"})
+	q.titleWeight = 2
+
+	title := scoreBlock(Block{Content: "Budget review", EntityType: "document"}, q, 0)
+	content := scoreBlock(Block{Content: "budget review", EntityType: "text"}, q, 1)
+	parentTitle := scoreBlock(Block{Content: "review notes", EntityType: "text", DocumentTitle: "Budget"}, q, 2)
+
+	if title.wordScore != 4 || content.wordScore != 2 {
+		t.Errorf("word scores = %v for the title, %v for content, want 4 and 2", title.wordScore, content.wordScore)
+	}
+	// One word in the title of its document, one in its content
+	if parentTitle.wordScore != 3 {
+		t.Errorf("word score = %v for a block of a matching document, want 3", parentTitle.wordScore)
+	}
+	if got := parentTitle.block.Match.MatchedWords; !equalStrings(got, []string{"review"}) {
+		t.Errorf("matched words = %v, want the words of the content only", got)
+	}
+}
+
+func TestSearchTitleWeight(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b1", "budget and 2024 notes", "doc2"),
+		document("doc1", "Budget"),
+	))
+
+	tests := []struct {
+		name   string
+		weight float64
+		want   []string
+	}{
+		{name: "title counts more", weight: 3, want: []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}},
+		{name: "title counts the same", weight: 1, want: []string{DocumentKey("s1", "b1"), DocumentKey("s1", "doc1")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"budget", "2024", "q3"}, SearchOptions{CurrentSpaceID: "s1", TitleWeight: tt.weight, MatchRatio: 0.3})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchParentTitleWeight(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b1", "road trip", "doc1"),
+		block("b2", "road trip", "doc2"),
+		document("doc1", "Packing list"),
+		document("doc2", "Summer trips"),
+	))
+
+	tests := []struct {
+		name   string
+		weight float64
+		want   []string
+	}{
+		{name: "parent title counts", weight: 2, want: []string{DocumentKey("s1", "b2"), DocumentKey("s1", "b1")}},
+		{name: "titles not weighed", weight: 0, want: []string{DocumentKey("s1", "b1"), DocumentKey("s1", "b2")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"road", "trip"}, SearchOptions{CurrentSpaceID: "s1", TitleWeight: tt.weight, BodyOnly: true})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPhraseOfRepeatedTerms(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("once", "plan ahead", "doc1"),
+		block("twice", "plan plan ahead", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", Phrase: "plan plan"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if want := []string{DocumentKey("s1", "twice"), DocumentKey("s1", "once")}; !equalStrings(keys(blocks), want) {
+		t.Fatalf("Search() = %v, want %v", keys(blocks), want)
+	}
+	if !blocks[0].Match.ExactMatch || blocks[1].Match.ExactMatch {
+		t.Errorf("ExactMatch = %t, %t, want the repeated phrase only", blocks[0].Match.ExactMatch, blocks[1].Match.ExactMatch)
+	}
+}
+
+func TestSearchJoinedMatch(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Trip"),
+		block("b1", "the road", "doc1"),
+		block("b2", "map of it", "doc1"),
+		document("doc2", "Other"),
+		block("b3", "road only", "doc2"),
+	))
+
+	for _, joined := range []bool{false, true} {
+		blocks, err := repo.Search(context.Background(), []string{"road", "map"}, SearchOptions{CurrentSpaceID: "s1", JoinedMatch: joined})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		var found *Block
+		for i, block := range blocks {
+			if block.ID == "doc1" {
+				found = &blocks[i]
+			}
+			if block.ID == "doc2" {
+				t.Errorf("JoinedMatch=%t found doc2, which lacks a word", joined)
+			}
+		}
+
+		switch {
+		case joined && (found == nil || !found.Match.JoinedMatch):
+			t.Errorf("JoinedMatch=%t results %v, want doc1 as a joined match", joined, keys(blocks))
+		case !joined && found != nil:
+			t.Errorf("JoinedMatch=%t found doc1 across its blocks", joined)
+		}
+	}
+}
+
+func TestSubsequenceScore(t *testing.T) {
+	tests := []struct {
+		text    string
+		pattern string
+		match   bool
+	}{
+		{"project plan", "prjpln", true},
+		{"project plan", "pp", true},
+		{"project plan", "plnprj", false},
+		{"project plan", "prjplnx", false},
+		{"plan", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := subsequenceScore(tt.text, tt.pattern); (got > 0) != tt.match {
+			t.Errorf("subsequenceScore(%q, %q) = %v, want a match: %t", tt.text, tt.pattern, got, tt.match)
+		}
+	}
+
+	// Word starts and a short title score higher
+	if tight, loose := subsequenceScore("project plan", "pp"), subsequenceScore("apple pie plan", "pp"); tight <= loose {
+		t.Errorf("score at word starts %v <= score within words %v", tight, loose)
+	}
+}
+
+func TestSearchSubsequence(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("plan", "Project Plan"),
+		document("other", "Planning"),
+		block("b1", "project planning notes", "plan"),
+	))
+
+	for _, enabled := range []bool{false, true} {
+		blocks, err := repo.Search(context.Background(), []string{"prjpln"}, SearchOptions{CurrentSpaceID: "s1", Subsequence: enabled})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		want := []string{}
+		if enabled {
+			want = []string{DocumentKey("s1", "plan")}
+		}
+		if !equalStrings(keys(blocks), want) {
+			t.Errorf("Subsequence=%t Search() = %v, want %v", enabled, keys(blocks), want)
+		}
+		if enabled && len(blocks) == 1 && !blocks[0].Match.Subsequence {
+			t.Error("the result is not marked as a subsequence match")
+		}
+	}
+}
+
+func TestContainsStandaloneNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"2024.01.05", true},
+		{"in 2024", true},
+		{"2024", true},
+		{"120245", false},
+		{"20241", false},
+		{"120245 and 2024", true},
+	}
+
+	for _, tt := range tests {
+		if got := containsStandaloneNumber(tt.text, "2024"); got != tt.want {
+			t.Errorf("containsStandaloneNumber(%q) = %t, want %t", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchNumericBoundary(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("embedded", "order 120245", "doc1"),
+		block("date", "2024.01.05 standup", "doc1"),
+	))
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    []string
+	}{
+		{name: "off keeps the index order", want: []string{DocumentKey("s1", "embedded"), DocumentKey("s1", "date")}},
+		{name: "on ranks the standalone number first", enabled: true, want: []string{DocumentKey("s1", "date"), DocumentKey("s1", "embedded")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"2024"}, SearchOptions{CurrentSpaceID: "s1", NumericBoundary: tt.enabled})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentBlocks(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b2", "second", "doc1"),
+		document("doc1", "Plan"),
+		block("x1", "elsewhere", "doc2"),
+		block("b1", "first", "doc1"),
+		block("empty", "", "doc1"),
+		block("b3", "third", "doc1"),
+	))
+
+	blocks, err := repo.DocumentBlocks(context.Background(), "s1", "doc1")
+	if err != nil {
+		t.Fatalf("DocumentBlocks() error = %v", err)
+	}
+
+	got := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		got = append(got, block.ID)
+		if block.SpaceID != "s1" || block.DocumentID != "doc1" {
+			t.Errorf("block %s is in %s/%s", block.ID, block.SpaceID, block.DocumentID)
+		}
+	}
+	if want := []string{"b2", "doc1", "b1", "b3"}; !equalStrings(got, want) {
+		t.Errorf("DocumentBlocks() = %v, want the stored order %v", got, want)
+	}
+
+	if _, err := repo.DocumentBlocks(context.Background(), "s2", "doc1"); err == nil {
+		t.Error("DocumentBlocks() in an unknown space succeeded")
+	}
+}
+
+func TestSearchNoSpacesLeft(t *testing.T) {
+	repo := NewBlockRepo()
+
+	for _, opts := range []SearchOptions{{AllSpaces: true}, {CurrentSpaceID: "s1"}} {
+		_, err := repo.Search(context.Background(), []string{"plan"}, opts)
+
+		var te types.Error
+		if !errors.As(err, &te) || te.Category != types.Config || te.Title != "All spaces excluded by configuration" {
+			t.Errorf("Search(%+v) error = %v, want the configuration to be blamed", opts, err)
+		}
+	}
+}
+
+func TestSearchBodyOnly(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Budget review"),
+		block("b1", "the budget review is on friday", "doc1"),
+		document("doc2", "Notes"),
+	))
+
+	tests := []struct {
+		name     string
+		bodyOnly bool
+		want     []string
+	}{
+		{name: "all candidates", want: []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}},
+		{name: "body only", bodyOnly: true, want: []string{DocumentKey("s1", "b1")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"budget", "review"}, SearchOptions{CurrentSpaceID: "s1", BodyOnly: tt.bodyOnly})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoState(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"- [ ] buy milk", TodoOpen},
+		{"[ ] buy milk", TodoOpen},
+		{"  * [x] buy milk", TodoDone},
+		{"- [X] buy milk", TodoDone},
+		{"buy milk [ ]", ""},
+		{"buy milk", ""},
+	}
+
+	for _, tt := range tests {
+		if got := todoState(tt.content); got != tt.want {
+			t.Errorf("todoState(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTodo(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("open", "- [ ] buy milk", "doc1"),
+		block("done", "- [x] buy milk", "doc1"),
+		block("plain", "milk is out", "doc1"),
+		block("inline", "milk [ ] later", "doc1"),
+	))
+
+	tests := []struct {
+		todo string
+		want []string
+	}{
+		{"", []string{DocumentKey("s1", "open"), DocumentKey("s1", "done"), DocumentKey("s1", "plain"), DocumentKey("s1", "inline")}},
+		{TodoOpen, []string{DocumentKey("s1", "open")}},
+		{TodoDone, []string{DocumentKey("s1", "done")}},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), []string{"milk"}, SearchOptions{CurrentSpaceID: "s1", Todo: tt.todo})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		got := make(map[string]bool)
+		for _, key := range keys(blocks) {
+			got[key] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Todo=%q Search() = %v, want %v", tt.todo, keys(blocks), tt.want)
+			continue
+		}
+		for _, key := range tt.want {
+			if !got[key] {
+				t.Errorf("Todo=%q Search() = %v, want %v", tt.todo, keys(blocks), tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDailyNotes(t *testing.T) {
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1",
+			document("d3", "2024.01.20"),
+			document("d1", "2024.01.05"),
+			document("d0", "2023.12.31"),
+			document("d4", "2024.02.01"),
+			document("plan", "Plan"),
+			block("b1", "2024.01.10", "plan"),
+		),
+		newTestSpace(t, "s2",
+			document("d2", "2024.01.10"),
+		),
+	)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+
+	blocks, err := repo.DailyNotes(context.Background(), from, to, SearchOptions{AllSpaces: true})
+	if err != nil {
+		t.Fatalf("DailyNotes() error = %v", err)
+	}
+
+	// Daily notes of every space in the range, oldest first, and neither
+	// other documents nor blocks with date-like content
+	want := []string{DocumentKey("s1", "d1"), DocumentKey("s2", "d2"), DocumentKey("s1", "d3")}
+	if got := keys(blocks); !equalStrings(got, want) {
+		t.Errorf("DailyNotes() = %v, want %v", got, want)
+	}
+}
+
+func TestDailyNotesCurrentSpace(t *testing.T) {
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1", document("d1", "2024.01.05")),
+		newTestSpace(t, "s2", document("d2", "2024.01.10")),
+	)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	blocks, err := repo.DailyNotes(context.Background(), from, from.AddDate(0, 1, 0), SearchOptions{CurrentSpaceID: "s2"})
+	if err != nil {
+		t.Fatalf("DailyNotes() error = %v", err)
+	}
+
+	if got, want := keys(blocks), []string{DocumentKey("s2", "d2")}; !equalStrings(got, want) {
+		t.Errorf("DailyNotes() = %v, want %v", got, want)
+	}
+}
+
+func TestMatchTiersScore(t *testing.T) {
+	// Each tier outranks every combination of the tiers below it
+	ordered := []Match{
+		{EqualMatch: true},
+		{StandaloneNumbers: true},
+		{TagMatch: true},
+		{ExactMatch: true},
+		{OrderedWordsMatch: true},
+		{AllWordsMatch: true, Acronym: true},
+		{AllWordsMatch: true},
+		{Acronym: true},
+		{},
+	}
+
+	var scorer MatchTiers
+	for i := 1; i < len(ordered); i++ {
+		higher := scorer.Score(Block{Match: ordered[i-1]}, ScoreQuery{})
+		lower := scorer.Score(Block{Match: ordered[i]}, ScoreQuery{})
+		if higher <= lower {
+			t.Errorf("Score(%+v) = %v, want it above Score(%+v) = %v", ordered[i-1], higher, ordered[i], lower)
+		}
+	}
+}
+
+func TestSearchCustomScorer(t *testing.T) {
+	space := newTestSpace(t, "s1",
+		block("b1", "road map", "doc1"),
+		block("b2", "a map of the road", "doc1"),
+		block("b3", "road", "doc1"),
+	)
+
+	var queries []ScoreQuery
+	repo := NewBlockRepo(space).WithScorer(ScorerFunc(func(block Block, query ScoreQuery) float64 {
+		queries = append(queries, query)
+		return float64(len(block.Content))
+	}))
+
+	blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []string{DocumentKey("s1", "b2"), DocumentKey("s1", "b1"), DocumentKey("s1", "b3")}
+	if got := keys(blocks); !equalStrings(got, want) {
+		t.Errorf("Search() = %v, want the custom order %v", got, want)
+	}
+	if len(queries) == 0 || queries[0].Phrase != "road" {
+		t.Errorf("scorer got queries %+v, want the phrase %q", queries, "road")
+	}
+}
+
+func TestWithScorerNilRestoresDefault(t *testing.T) {
+	repo := NewBlockRepo().WithScorer(ScorerFunc(func(Block, ScoreQuery) float64 { return 0 }))
+
+	repo.WithScorer(nil)
+
+	if _, ok := repo.scorer.(MatchTiers); !ok {
+		t.Errorf("scorer = %T, want MatchTiers", repo.scorer)
+	}
+}
+
+func TestSearchJSONContent(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b1", `{"type": "text", "content": [{"text": "buy milk"}]}`, "doc1"),
+		block("b2", "milk is out", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"milk"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, block := range blocks {
+		contents[block.ID] = block.Content
+	}
+	if contents["b1"] != "buy milk" {
+		t.Errorf("JSON block content = %q, want its text", contents["b1"])
+	}
+	if contents["b2"] != "milk is out" {
+		t.Errorf("plain block content = %q, want it unchanged", contents["b2"])
+	}
+}
+
+func TestBackfillDocumentIcons(t *testing.T) {
+	withIcon := document("doc1", "Plan")
+	withIcon.Icon = " 🗺️ "
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1",
+			withIcon,
+			block("b1", "road map", "doc1"),
+			document("doc2", "Notes"),
+			block("b2", "road trip", "doc2"),
+		),
+		newBareSpace(t, "s2", "id", "content", "type", "entityType", "customRank", "isTodo", "isTodoChecked", "documentId"),
+	)
+
+	blocks, err := repo.BackfillDocumentNames(context.Background(), []Block{
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "b2", DocumentID: "doc2", SpaceID: "s1"},
+		{ID: "b3", DocumentID: "doc1", SpaceID: "s2"},
+	}, map[string]struct{}{"s1": {}, "s2": {}})
+	if err != nil {
+		t.Fatalf("BackfillDocumentNames() error = %v", err)
+	}
+
+	// An index without an icon column leaves the blocks without an icon
+	for i, want := range []string{"🗺️", "", ""} {
+		if blocks[i].DocumentIcon != want {
+			t.Errorf("icon of %s = %q, want %q", blocks[i].ID, blocks[i].DocumentIcon, want)
+		}
+	}
+}
+
+func TestSearchWordPassThreshold(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []testRow
+		want bool // whether the per-word pass ran
+	}{
+		{
+			name: "common terms skip the word pass",
+			rows: []testRow{
+				block("b1", "road trip plans", "doc1"),
+				block("b2", "another road trip", "doc1"),
+				block("b3", "trip planning", "doc1"),
+			},
+			want: false,
+		},
+		{
+			name: "rare terms run the word pass",
+			rows: []testRow{
+				block("b1", "road trip plans", "doc1"),
+				block("b3", "trip planning", "doc1"),
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewBlockRepo(newTestSpace(t, "s1", tt.rows...))
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			if _, err := repo.Search(context.Background(), []string{"road", "trip"}, SearchOptions{CurrentSpaceID: "s1", WordPassThreshold: 2}); err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if ran := strings.Contains(logs.String(), "for individual word"); ran != tt.want {
+				t.Errorf("word pass ran = %t, want %t", ran, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchDeterministic(t *testing.T) {
+	var spaces []Space
+	for _, spaceID := range []string{"s1", "s2", "s3"} {
+		var rows []testRow
+		for i := 0; i < 6; i++ {
+			docID := fmt.Sprintf("doc%d", i)
+			rows = append(rows,
+				document(docID, fmt.Sprintf("Road map %d", i%2)),
+				block("a"+docID, "road map", docID),
+				block("b"+docID, "the map of the road", docID),
+				block("c"+docID, "road trip", docID),
+			)
+		}
+		spaces = append(spaces, newTestSpace(t, spaceID, rows...))
+	}
+	repo := NewBlockRepo(spaces...)
+
+	var first []byte
+	for run := 0; run < 50; run++ {
+		blocks, err := repo.Search(context.Background(), []string{"road", "map"}, SearchOptions{AllSpaces: true, ResultLimit: 20, FetchLimit: 10, MatchRatio: 0.5})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		targetSpaceIDs := map[string]struct{}{"s1": {}, "s2": {}, "s3": {}}
+		if blocks, err = repo.BackfillDocumentNames(context.Background(), blocks, targetSpaceIDs); err != nil {
+			t.Fatalf("BackfillDocumentNames() error = %v", err)
+		}
+
+		output, err := json.Marshal(blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = output
+			continue
+		}
+		if string(output) != string(first) {
+			t.Fatalf("run %d ranked\n%s\nwant\n%s", run, output, first)
+		}
+	}
+}
+
+func TestSearchMatchRatio(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("all", "road map for the trip budget", "doc1"),
+		block("three", "road map for the trip", "doc1"),
+		block("two", "road map", "doc1"),
+		block("one", "road works", "doc1"),
+	))
+
+	tests := []struct {
+		ratio float64
+		want  []string
+	}{
+		{ratio: 0, want: []string{"all"}},
+		{ratio: 1, want: []string{"all"}},
+		{ratio: 0.75, want: []string{"all", "three"}},
+		{ratio: 0.5, want: []string{"all", "three", "two"}},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), []string{"road", "map", "trip", "budget"}, SearchOptions{CurrentSpaceID: "s1", MatchRatio: tt.ratio})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		// Results matching more of the words rank first
+		var got []string
+		for _, block := range blocks {
+			got = append(got, block.ID)
+		}
+		if !equalStrings(got, tt.want) {
+			t.Errorf("MatchRatio=%v Search() = %v, want %v", tt.ratio, got, tt.want)
+		}
+	}
+}
+
+func TestScoreBlockFirstMatch(t *testing.T) {
+	query := newSearchQuery([]string{"road", "map"})
+
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{"road map", 0},
+		{"the map of the road", 4},
+		{"a Road", 2},
+		{"nothing here", len("nothing here")},
+	}
+
+	for _, tt := range tests {
+		if got := scoreBlock(Block{Content: tt.content}, query, 0).firstMatch; got != tt.want {
+			t.Errorf("firstMatch of %q = %d, want %d", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestSearchEarlyMatch(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("late", "notes about the road", "doc1"),
+		block("early", "road notes", "doc1"),
+	))
+
+	tests := []struct {
+		earlyMatch bool
+		want       []string
+	}{
+		{earlyMatch: false, want: []string{DocumentKey("s1", "late"), DocumentKey("s1", "early")}},
+		{earlyMatch: true, want: []string{DocumentKey("s1", "early"), DocumentKey("s1", "late")}},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1", EarlyMatch: tt.earlyMatch})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if got := keys(blocks); !equalStrings(got, tt.want) {
+			t.Errorf("EarlyMatch=%t Search() = %v, want %v", tt.earlyMatch, got, tt.want)
+		}
+	}
+}
+
+func TestIsHeading(t *testing.T) {
+	tests := []struct {
+		block Block
+		want  bool
+	}{
+		{Block{EntityType: "text", Content: "## Risks"}, true},
+		{Block{EntityType: "text", Content: "# Plan"}, true},
+		{Block{EntityType: "heading", Content: "Risks"}, true},
+		{Block{EntityType: "text", Content: "#tag in text"}, false},
+		{Block{EntityType: "text", Content: "####### too deep"}, false},
+		{Block{EntityType: "text", Content: "plain"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.block.IsHeading(); got != tt.want {
+			t.Errorf("IsHeading(%+v) = %t, want %t", tt.block, got, tt.want)
+		}
+	}
+}
+
+func TestBackfillHeadings(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Plan"),
+		block("intro", "before any heading", "doc1"),
+		block("h1", "## Goals", "doc1"),
+		block("goal", "ship the road map", "doc1"),
+		block("h2", "# Risks", "doc1"),
+		block("risk", "the road is long", "doc1"),
+		document("doc2", "Notes"),
+		block("note", "road trip", "doc2"),
+	))
+
+	blocks := []Block{
+		{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan"},
+		{ID: "intro", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "goal", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "h2", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "risk", DocumentID: "doc1", SpaceID: "s1"},
+		{ID: "note", DocumentID: "doc2", SpaceID: "s1"},
+	}
+	if err := repo.BackfillHeadings(context.Background(), blocks); err != nil {
+		t.Fatalf("BackfillHeadings() error = %v", err)
+	}
+
+	want := []string{"", "", "Goals", "Goals", "Risks", ""}
+	for i, block := range blocks {
+		if block.HeadingContext != want[i] {
+			t.Errorf("heading of %s = %q, want %q", block.ID, block.HeadingContext, want[i])
+		}
+	}
+}
+
+func TestBackfillDocumentNamesOrphans(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Plan"),
+		block("b1", "road map", "doc1"),
+		block("orphan", "road trip", ""),
+		block("self", "road works", "self"),
+	))
+
+	blocks, err := repo.BackfillDocumentNames(context.Background(), []Block{
+		{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan"},
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1", EntityType: "text"},
+		{ID: "orphan", SpaceID: "s1", EntityType: "text"},
+		{ID: "self", DocumentID: "self", SpaceID: "s1", EntityType: "text"},
+	}, map[string]struct{}{"s1": {}})
+	if err != nil {
+		t.Fatalf("BackfillDocumentNames() error = %v", err)
+	}
+
+	want := []struct {
+		name  string
+		title string
+	}{
+		{"[Document]", "Plan"},
+		{"[Block] Plan", "Plan"},
+		{"[Block] (orphan)", ""},
+		{"[Block] (orphan)", ""},
+	}
+	for i, block := range blocks {
+		if block.DocumentName != want[i].name || block.DocumentTitle != want[i].title {
+			t.Errorf("%s: name %q, title %q, want %q, %q", block.ID, block.DocumentName, block.DocumentTitle, want[i].name, want[i].title)
+		}
+	}
+}
+
+func TestSearchFolder(t *testing.T) {
+	inFolder := document("doc1", "Plan A")
+	inFolder.FolderID = "f1"
+	subfolder := document("doc2", "Plan B")
+	subfolder.FolderID = "f2"
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		inFolder,
+		block("b1", "plan details", "doc1"),
+		subfolder,
+		block("b2", "plan notes", "doc2"),
+		document("doc3", "Plan C"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", FolderID: "f1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if want := []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() = %v, want the folder's document and its blocks %v", keys(blocks), want)
+	}
+}
+
+func TestSearchFolderWithoutTerms(t *testing.T) {
+	inFolder := document("doc1", "Plan A")
+	inFolder.FolderID = "f1"
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		inFolder,
+		block("b1", "details", "doc1"),
+		document("doc2", "Plan B"),
+	))
+
+	blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", FolderID: "f1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, key := range keys(blocks) {
+		got[key] = true
+	}
+	if len(got) != 2 || !got[DocumentKey("s1", "doc1")] || !got[DocumentKey("s1", "b1")] {
+		t.Errorf("Search() = %v, want the whole folder", keys(blocks))
+	}
+}
+
+func TestSearchFolderUnavailable(t *testing.T) {
+	repo := NewBlockRepo(newBareSpace(t, "s1", "id", "content", "type", "entityType", "customRank", "isTodo", "isTodoChecked", "documentId"))
+
+	_, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", FolderID: "f1"})
+
+	var te types.Error
+	if !errors.As(err, &te) || te.Title != "Folder filter unavailable" {
+		t.Errorf("Search() error = %v, want the folder filter reported unavailable", err)
+	}
+}
+
+func TestAcronymMatch(t *testing.T) {
+	tests := []struct {
+		text    string
+		pattern string
+		want    bool
+	}{
+		{"product requirements doc", "prd", true},
+		{"product requirements doc", "pr", true},
+		{"product-requirements (doc)", "prd", true},
+		{"product requirements", "prd", false},
+		{"production road", "prd", false},
+		{"requirements product doc", "prd", false},
+		{"product requirements doc", "p", false},
+	}
+
+	for _, tt := range tests {
+		if got := acronymMatch(tt.text, tt.pattern); got != tt.want {
+			t.Errorf("acronymMatch(%q, %q) = %t, want %t", tt.text, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSearchAcronym(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Product Requirements Doc"),
+		document("doc2", "Production Road"),
+		document("doc3", "PRD template"),
+		block("b1", "product requirements doc", "doc2"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"PRD"}, SearchOptions{CurrentSpaceID: "s1", Acronym: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	// The substring match leads, the acronym of a title is a lower tier and
+	// blocks never match by acronym
+	want := []string{DocumentKey("s1", "doc3"), DocumentKey("s1", "doc1")}
+	if got := keys(blocks); !equalStrings(got, want) {
+		t.Fatalf("Search() = %v, want %v", got, want)
+	}
+	if !blocks[1].Match.Acronym || blocks[0].Match.Acronym {
+		t.Errorf("Acronym = %t, %t, want only the acronym match marked", blocks[0].Match.Acronym, blocks[1].Match.Acronym)
+	}
+
+	blocks, err = repo.Search(context.Background(), []string{"PRD"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if want := []string{DocumentKey("s1", "doc3")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() without ACRONYM = %v, want %v", keys(blocks), want)
+	}
+}
+
+func TestSearchTimings(t *testing.T) {
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1", block("b1", "road map", "doc1")),
+		newTestSpace(t, "s2", block("b2", "road trip", "doc2")),
+	)
+
+	if _, err := repo.Search(context.Background(), []string{"road", "map"}, SearchOptions{AllSpaces: true}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	timings := repo.Timings()
+	if len(timings.Spaces) != 2 || timings.Spaces[0].SpaceID != "s1" || timings.Spaces[1].SpaceID != "s2" {
+		t.Fatalf("Spaces = %+v, want a timing for s1 and s2", timings.Spaces)
+	}
+	for _, space := range timings.Spaces {
+		if space.Duration <= 0 {
+			t.Errorf("Duration of %s = %v, want it measured", space.SpaceID, space.Duration)
+		}
+	}
+	if timings.Scoring < 0 {
+		t.Errorf("Scoring = %v, want it non-negative", timings.Scoring)
+	}
+
+	// Every search starts its own timings
+	if _, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s2"}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if spaces := repo.Timings().Spaces; len(spaces) != 1 || spaces[0].SpaceID != "s2" {
+		t.Errorf("Spaces = %+v, want the searched space only", spaces)
+	}
+}
+
+func TestSearchRecentBy(t *testing.T) {
+	day := func(d int) float64 {
+		return float64(time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC).Unix())
+	}
+	edited := document("edited", "Edited lately")
+	edited.Created, edited.Modified = day(1), day(30)
+	created := document("created", "Created lately")
+	created.Created, created.Modified = day(29), day(2)
+	middle := document("middle", "In between")
+	middle.Created, middle.Modified = day(15), day(15)
+
+	repo := NewBlockRepo(newTestSpace(t, "s1", edited, block("b1", "not a document", "edited"), created, middle))
+
+	tests := []struct {
+		recentBy string
+		want     []string
+	}{
+		{recentBy: RecentByModified, want: []string{"edited", "middle", "created"}},
+		{recentBy: RecentByCreated, want: []string{"created", "middle", "edited"}},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", RecentBy: tt.recentBy})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+
+		var got []string
+		for _, block := range blocks {
+			got = append(got, block.ID)
+		}
+		if !equalStrings(got, tt.want) {
+			t.Errorf("RecentBy=%s Search() = %v, want %v", tt.recentBy, got, tt.want)
+		}
+	}
+}
+
+func TestSearchMaxWordPasses(t *testing.T) {
+	var spaces []Space
+	for _, spaceID := range []string{"s1", "s2", "s3"} {
+		spaces = append(spaces, newTestSpace(t, spaceID,
+			block("a", "alpha only", "doc1"),
+			block("b", "beta only", "doc1"),
+			block("c", "gammalong only", "doc1"),
+		))
+	}
+	repo := NewBlockRepo(spaces...)
+	terms := []string{"alpha", "beta", "gammalong"}
+
+	tests := []struct {
+		maxPasses int
+		want      int
+	}{
+		{maxPasses: 0, want: 9},
+		{maxPasses: 3, want: 3},
+		{maxPasses: 4, want: 4},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), terms, SearchOptions{AllSpaces: true, MatchRatio: 0.3, MaxWordPasses: tt.maxPasses})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if len(blocks) != tt.want {
+			t.Errorf("MaxWordPasses=%d found %v, want %d results", tt.maxPasses, keys(blocks), tt.want)
+		}
+
+		// The longest word runs first in every space
+		if tt.maxPasses == 3 {
+			for _, block := range blocks {
+				if block.ID != "c" {
+					t.Errorf("MaxWordPasses=3 found %v, want the longest word's blocks", keys(blocks))
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestContainsOrderedWords(t *testing.T) {
+	tests := []struct {
+		text    string
+		ordered bool
+		span    int
+	}{
+		{"road map", true, len("road map")},
+		{"the road to the map", true, len("road to the map")},
+		{"map of the road", false, 0},
+		{"road only", false, 0},
+	}
+
+	for _, tt := range tests {
+		ordered, span := containsOrderedWords(tt.text, []string{"road", "map"})
+		if ordered != tt.ordered || span != tt.span {
+			t.Errorf("containsOrderedWords(%q) = %t, %d, want %t, %d", tt.text, ordered, span, tt.ordered, tt.span)
+		}
+	}
+}
+
+func TestScoreBlockAdjacency(t *testing.T) {
+	query := newSearchQuery([]string{"road", "map"})
+
+	tight := scoreBlock(Block{Content: "road to map"}, query, 0).adjacency
+	loose := scoreBlock(Block{Content: "road trip and a long detour to the map"}, query, 0).adjacency
+	exact := scoreBlock(Block{Content: "a road map"}, query, 0).adjacency
+	unordered := scoreBlock(Block{Content: "map the road"}, query, 0).adjacency
+
+	if exact != 1 {
+		t.Errorf("adjacency of a contiguous phrase = %v, want 1", exact)
+	}
+	if !(tight > loose && loose > 0) {
+		t.Errorf("adjacency tight = %v, loose = %v, want tight above loose", tight, loose)
+	}
+	if unordered != 0 {
+		t.Errorf("adjacency of words out of order = %v, want 0", unordered)
+	}
+}
+
+func TestSearchRanksTightOrderedWords(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("loose", "road trip and a long detour to the map", "doc1"),
+		block("tight", "road to map", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"road", "map"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []string{DocumentKey("s1", "tight"), DocumentKey("s1", "loose")}
+	if got := keys(blocks); !equalStrings(got, want) {
+		t.Errorf("Search() = %v, want the words close together first %v", got, want)
+	}
+}
+
+func TestSearchDisablePasses(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("road", "road works", "doc1"),
+		block("trip", "trip report", "doc1"),
+		block("both", "road trip", "doc1"),
+	))
+
+	tests := []struct {
+		name             string
+		opts             SearchOptions
+		phrase, wordPass bool // whether each pass ran
+	}{
+		{name: "both passes", phrase: true, wordPass: true},
+		{name: "phrase pass disabled", opts: SearchOptions{DisablePhrasePass: true}, wordPass: true},
+		{name: "word pass disabled", opts: SearchOptions{DisableWordPass: true}, phrase: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.CurrentSpaceID = "s1"
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			if _, err := repo.Search(context.Background(), []string{"road", "trip"}, opts); err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if ran := strings.Contains(logs.String(), "for full phrase"); ran != tt.phrase {
+				t.Errorf("phrase pass ran = %t, want %t", ran, tt.phrase)
+			}
+			if ran := strings.Contains(logs.String(), "for individual word"); ran != tt.wordPass {
+				t.Errorf("word pass ran = %t, want %t", ran, tt.wordPass)
+			}
+		})
+	}
+}
+
+func TestSearchDisableBothPasses(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1", block("b1", "road trip", "doc1")))
+
+	_, err := repo.Search(context.Background(), []string{"road", "trip"}, SearchOptions{
+		CurrentSpaceID:    "s1",
+		DisablePhrasePass: true,
+		DisableWordPass:   true,
+	})
+
+	var typed types.Error
+	if !errors.As(err, &typed) || typed.Category != types.Config {
+		t.Errorf("Search() error = %v, want a configuration error", err)
+	}
+}
+
+func TestSearchFolderPath(t *testing.T) {
+	inProjects := document("doc1", "Plan A")
+	inProjects.FolderID = "Work Projects"
+	inArchive := document("doc2", "Plan B")
+	inArchive.FolderID = "Work Archive"
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		inProjects,
+		block("b1", "plan details", "doc1"),
+		inArchive,
+		block("b2", "plan notes", "doc2"),
+		document("doc3", "Plan C"),
+	))
+
+	tests := []struct {
+		path []string
+		want []string
+	}{
+		{path: []string{"work", "projects"}, want: []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}},
+		{path: []string{"archive"}, want: []string{DocumentKey("s1", "doc2"), DocumentKey("s1", "b2")}},
+		{path: []string{"projects", "work"}, want: nil},
+		{path: []string{"work", "archive", "projects"}, want: nil},
+		{path: []string{"home"}, want: nil},
+		{path: []string{"50%"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), []string{"plan"}, SearchOptions{CurrentSpaceID: "s1", FolderPath: tt.path})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if got := keys(blocks); !equalStrings(got, tt.want) {
+			t.Errorf("FolderPath %q Search() = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSearchDocPriority(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Map of the old road"),
+		block("b1", "the road map", "doc2"),
+	))
+
+	tests := []struct {
+		priority string
+		want     []string
+	}{
+		{priority: "", want: []string{DocumentKey("s1", "b1"), DocumentKey("s1", "doc1")}},
+		{priority: DocPriorityRelevance, want: []string{DocumentKey("s1", "b1"), DocumentKey("s1", "doc1")}},
+		{priority: DocPriorityStrict, want: []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1")}},
+	}
+
+	for _, tt := range tests {
+		blocks, err := repo.Search(context.Background(), []string{"road", "map"}, SearchOptions{CurrentSpaceID: "s1", DocPriority: tt.priority})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if got := keys(blocks); !equalStrings(got, tt.want) {
+			t.Errorf("DocPriority %q Search() = %v, want %v", tt.priority, got, tt.want)
+		}
+	}
+}
+
+func TestSearchDocumentsOnly(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document("doc1", "Road trip"),
+		block("b1", "road map", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1", DocumentsOnly: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if want := []string{DocumentKey("s1", "doc1")}; !equalStrings(keys(blocks), want) {
+		t.Errorf("Search() = %v, want the document only %v", keys(blocks), want)
+	}
+}
+
+func TestSearchSameIDInSeveralSpaces(t *testing.T) {
+	repo := NewBlockRepo(
+		newTestSpace(t, "s1", document("doc1", "Roadmap"), block("b1", "roadmap draft", "doc1")),
+		newTestSpace(t, "s2", document("doc1", "Roadmap"), block("b1", "roadmap final", "doc1")),
+	)
+
+	blocks, err := repo.Search(context.Background(), []string{"roadmap"}, SearchOptions{AllSpaces: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, key := range keys(blocks) {
+		got[key] = true
+	}
+	for _, want := range []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b1"), DocumentKey("s2", "doc1"), DocumentKey("s2", "b1")} {
+		if !got[want] {
+			t.Errorf("Search() = %v, missing %s", keys(blocks), want)
+		}
+	}
+}
+
+func TestSearchSortByModified(t *testing.T) {
+	old := block("old", "road works", "doc1")
+	recent := block("recent", "road trip", "doc2")
+	oldDoc, recentDoc := document("doc1", "Archive"), document("doc2", "Travel")
+	oldDoc.Modified = float64(time.Now().AddDate(-1, 0, 0).Unix())
+	recentDoc.Modified = float64(time.Now().Unix())
+	repo := NewBlockRepo(newTestSpace(t, "s1", old, recent, oldDoc, recentDoc))
+
+	tests := []struct {
+		name           string
+		modifiedColumn string
+		want           []string
+	}{
+		{name: "newest document first", want: []string{DocumentKey("s1", "recent"), DocumentKey("s1", "old")}},
+		{name: "configured column", modifiedColumn: "modified", want: []string{DocumentKey("s1", "recent"), DocumentKey("s1", "old")}},
+		{name: "missing column keeps relevance", modifiedColumn: "editedAt", want: []string{DocumentKey("s1", "old"), DocumentKey("s1", "recent")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1", SortBy: SortByModified, ModifiedColumn: tt.modifiedColumn})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !equalStrings(keys(blocks), tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// textKeys are the keys of structured content that hold readable text.
+var textKeys = map[string]bool{
+	"text":    true,
+	"content": true,
+	"title":   true,
+	"value":   true,
+	"string":  true,
+}
+
+// plainContent extracts the readable text of content stored as a JSON
+// structure, so that keys and braces are neither matched nor displayed.
+// Content that is not JSON is returned unchanged.
+func plainContent(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return content
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return content
+	}
+
+	texts := collectTexts(v, false, nil)
+	if len(texts) == 0 {
+		// No text keys, any string will do
+		texts = collectTexts(v, true, nil)
+	}
+	if len(texts) == 0 {
+		return content
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// collectTexts appends the non-empty strings found under textKeys, or every
+// string when all is set. Object keys are visited in sorted order.
+func collectTexts(v interface{}, all bool, texts []string) []string {
+	switch value := v.(type) {
+	case string:
+		if all && strings.TrimSpace(value) != "" {
+			texts = append(texts, value)
+		}
+	case []interface{}:
+		for _, item := range value {
+			texts = collectTexts(item, all, texts)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			texts = collectTexts(value[key], all || textKeys[strings.ToLower(key)], texts)
+		}
+	}
+	return texts
+}
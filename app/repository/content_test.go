@@ -0,0 +1,26 @@
+package repository
+
+import "testing"
+
+func TestPlainContent(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"buy milk", "buy milk"},
+		{"{braces} in text", "{braces} in text"},
+		{`{"text": "buy milk"}`, "buy milk"},
+		{`{"type": "text", "content": [{"text": "buy"}, {"text": "milk", "bold": true}]}`, "buy milk"},
+		{`[{"value": "road"}, {"value": "map"}]`, "road map"},
+		{`{"id": "x1", "label": "no text keys"}`, "x1 no text keys"},
+		{`{"text": ""}`, `{"text": ""}`},
+		{`{"text": "unterminated"`, `{"text": "unterminated"`},
+		{"[ ] todo", "[ ] todo"},
+	}
+
+	for _, tt := range tests {
+		if got := plainContent(tt.content); got != tt.want {
+			t.Errorf("plainContent(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
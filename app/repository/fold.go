@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldFunction is the name of the SQL function FoldDiacritics is registered
+// under on index connections.
+const FoldFunction = "fold_diacritics"
+
+// strokedLetters maps the lowercase Latin letters whose diacritic is part
+// of the letter, and so is not split off by Unicode decomposition, to their
+// base letter.
+var strokedLetters = map[rune]rune{
+	'ø': 'o',
+	'đ': 'd',
+	'ħ': 'h',
+	'ı': 'i',
+	'ł': 'l',
+	'ŧ': 't',
+}
+
+// FoldDiacritics lowercases the text and strips the diacritics of its Latin
+// letters, so that "Café" becomes "cafe". The text is decomposed and the
+// combining marks following a Latin letter dropped; the marks of other
+// scripts are kept and recomposed as they were.
+func FoldDiacritics(text string) string {
+	var folded strings.Builder
+	latin := false
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			if latin {
+				continue
+			}
+		} else {
+			latin = unicode.Is(unicode.Latin, r)
+			r = unicode.ToLower(r)
+			if base, ok := strokedLetters[r]; ok {
+				r = base
+			}
+		}
+		folded.WriteRune(r)
+	}
+
+	return norm.NFC.String(folded.String())
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// foldDriver is go-sqlite3 with FoldFunction registered, as on the index
+// connections of the workflow.
+const foldDriver = "sqlite3_fold"
+
+var registerFoldDriver sync.Once
+
+// newFoldSpace is newTestSpace with FoldFunction available to the queries.
+func newFoldSpace(t *testing.T, id string, rows ...testRow) Space {
+	t.Helper()
+
+	registerFoldDriver.Do(func() {
+		sql.Register(foldDriver, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc(FoldFunction, FoldDiacritics, true)
+			},
+		})
+	})
+
+	return newDriverSpace(t, foldDriver, id, rows...)
+}
+
+func TestFoldDiacritics(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{name: "latin accents", text: "Café Crème Brûlée", want: "cafe creme brulee"},
+		{name: "latin precomposed and combining", text: "Ångström naïve", want: "angstrom naive"},
+		{name: "stroked letters", text: "Łódź Øre Đak", want: "lodz ore dak"},
+		{name: "plain text", text: "Road Map", want: "road map"},
+		{name: "greek keeps its accents", text: "Καλημέρα", want: "καλημέρα"},
+		{name: "cyrillic keeps its breve", text: "Йогурт", want: "йогурт"},
+		{name: "japanese keeps its dakuten", text: "がぎぐ", want: "がぎぐ"},
+		{name: "mixed scripts", text: "café ή", want: "cafe ή"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FoldDiacritics(tt.text); got != tt.want {
+				t.Errorf("FoldDiacritics(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFoldFunction(t *testing.T) {
+	space := newFoldSpace(t, "s1")
+
+	var got string
+	if err := space.DB.QueryRow("SELECT "+FoldFunction+"(?)", "Crème Brûlée").Scan(&got); err != nil {
+		t.Fatalf("%s() error = %v", FoldFunction, err)
+	}
+	if got != "creme brulee" {
+		t.Errorf("%s() = %q, want %q", FoldFunction, got, "creme brulee")
+	}
+}
+
+func TestSearchFoldDiacritics(t *testing.T) {
+	repo := NewBlockRepo(newFoldSpace(t, "s1",
+		document("doc1", "Café notes"),
+		block("b1", "crème brûlée recipe", "doc1"),
+		block("b2", "cafeteria menu", "doc1"),
+	))
+
+	tests := []struct {
+		name  string
+		terms []string
+		fold  bool
+		want  []string
+	}{
+		{name: "folded terms find accents", terms: []string{"cafe"}, fold: true, want: []string{DocumentKey("s1", "doc1"), DocumentKey("s1", "b2")}},
+		{name: "accented terms find plain text", terms: []string{"crème", "brulee"}, fold: true, want: []string{DocumentKey("s1", "b1")}},
+		{name: "without folding accents must match", terms: []string{"creme"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := repo.Search(context.Background(), tt.terms, SearchOptions{CurrentSpaceID: "s1", FoldDiacritics: tt.fold})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			got := make(map[string]bool)
+			for _, key := range keys(blocks) {
+				got[key] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Search() = %v, want %v", keys(blocks), tt.want)
+			}
+			for _, key := range tt.want {
+				if !got[key] {
+					t.Errorf("Search() = %v, missing %s", keys(blocks), key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// contentTable is the FTS5 shadow table holding the indexed rows.
+const contentTable = "BlockSearch_content"
+
+// contentTableExpr returns what every query of the space reads from: the
+// content table, or when it is empty while the BlockSearch virtual table has
+// rows, the virtual table with its columns renamed to the c0, c1, ... of the
+// content table. The result is remembered per space.
+func (b *BlockRepo) contentTableExpr(ctx context.Context, space Space) string {
+	if expr, ok := b.contentTables[space.ID]; ok {
+		return expr
+	}
+	if b.contentTables == nil {
+		b.contentTables = make(map[string]string)
+	}
+
+	expr, err := b.virtualTableExpr(ctx, space)
+	if err != nil {
+		log.Printf("Checking the content table of %s failed, using it: %v", space.ID, err)
+	}
+	if expr == "" {
+		expr = contentTable
+	} else {
+		log.Printf("Content table of %s is empty, searching the virtual table", space.ID)
+	}
+
+	b.contentTables[space.ID] = expr
+	return expr
+}
+
+// virtualTableExpr returns the virtual table as a subquery when the content
+// table is empty but the virtual table is not, or "" otherwise.
+func (b *BlockRepo) virtualTableExpr(ctx context.Context, space Space) (string, error) {
+	var hasContent bool
+	if err := space.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+contentTable+")").Scan(&hasContent); err != nil {
+		return "", types.NewError("failed to check the content table", err)
+	}
+	if hasContent {
+		return "", nil
+	}
+
+	var hasRows bool
+	if err := space.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM BlockSearch)").Scan(&hasRows); err != nil {
+		return "", types.NewError("failed to check the virtual table", err)
+	}
+	if !hasRows {
+		return "", nil
+	}
+
+	rows, err := space.DB.QueryContext(ctx, "SELECT name FROM pragma_table_info('BlockSearch') ORDER BY cid")
+	if err != nil {
+		return "", types.NewError("failed to inspect the search index", err)
+	}
+
+	columns := []string{"rowid"}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return "", types.NewError("failed to scan a row", err)
+		}
+		columns = append(columns, fmt.Sprintf(`"%s" AS c%d`, strings.ReplaceAll(name, `"`, `""`), len(columns)-1))
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", types.NewError("error in rows", err)
+	}
+
+	if err = rows.Close(); err != nil {
+		return "", types.NewError("closing rows failed", err)
+	}
+
+	return "(SELECT " + strings.Join(columns, ", ") + " FROM BlockSearch)", nil
+}
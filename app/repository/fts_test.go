@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVirtualOnlySpace creates a search index whose BlockSearch virtual table
+// reads its rows from another table, next to an empty BlockSearch_content.
+func newVirtualOnlySpace(t *testing.T, id string, rows ...testRow) Space {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), id+".sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	contentColumns := make([]string, len(testColumns))
+	for i := range testColumns {
+		contentColumns[i] = fmt.Sprintf("c%d", i)
+	}
+
+	statements := []string{
+		"CREATE TABLE Blocks (" + strings.Join(testColumns, ", ") + ")",
+		"CREATE VIRTUAL TABLE BlockSearch USING fts5(" + strings.Join(testColumns, ", ") + ", content='Blocks')",
+		"CREATE TABLE BlockSearch_content (id INTEGER PRIMARY KEY, " + strings.Join(contentColumns, ", ") + ")",
+	}
+	for _, statement := range statements {
+		if _, err = db.Exec(statement); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	for _, row := range rows {
+		_, err = db.Exec(
+			"INSERT INTO Blocks VALUES (?, ?, '', ?, 0, 0, 0, ?, 0, ?, ?, ?, ?, ?)",
+			row.ID, row.Content, row.EntityType, row.DocumentID, row.FolderID, row.Modified, row.Created, row.Icon, row.FileName,
+		)
+		if err != nil {
+			t.Fatalf("insert %s: %v", row.ID, err)
+		}
+	}
+
+	return Space{ID: id, DB: db}
+}
+
+func TestContentTableExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		space   Space
+		virtual bool
+	}{
+		{name: "content table holds the rows", space: newTestSpace(t, "s1", block("b1", "road map", "doc1"))},
+		{name: "both empty", space: newTestSpace(t, "s1")},
+		{name: "virtual table only", space: newVirtualOnlySpace(t, "s1", block("b1", "road map", "doc1")), virtual: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := NewBlockRepo(tt.space).contentTableExpr(context.Background(), tt.space)
+			if virtual := expr != contentTable; virtual != tt.virtual {
+				t.Errorf("contentTableExpr() = %q, want the virtual table %t", expr, tt.virtual)
+			}
+		})
+	}
+}
+
+func TestSearchVirtualTableOnly(t *testing.T) {
+	repo := NewBlockRepo(newVirtualOnlySpace(t, "s1",
+		document("doc1", "Travel"),
+		block("b1", "road map", "doc1"),
+		block("b2", "packing list", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), []string{"road"}, SearchOptions{CurrentSpaceID: "s1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if want := []string{DocumentKey("s1", "b1")}; !equalStrings(keys(blocks), want) {
+		t.Fatalf("Search() = %v, want %v", keys(blocks), want)
+	}
+
+	titles, err := repo.DocumentTitles(context.Background(), blocks)
+	if err != nil {
+		t.Fatalf("DocumentTitles() error = %v", err)
+	}
+	if title := titles[DocumentKey("s1", "doc1")]; title != "Travel" {
+		t.Errorf("DocumentTitles() = %v, want the title read from the virtual table", titles)
+	}
+}
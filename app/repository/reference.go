@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// regexReference matches the content of a linked reference block: the ID of
+// the referenced document, bare, as a mention token such as "@ID" or "[[ID]]",
+// or as a craftdocs:// link.
+var regexReference = regexp.MustCompile(`^\s*(?:@|\[\[)?(?:craftdocs://open\?blockId=)?([0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12})(?:&\S*)?(?:\]\])?\s*$`)
+
+// referencedID returns the ID a linked reference block points to, or "" for
+// any other content.
+func referencedID(content string) string {
+	match := regexReference.FindStringSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// backfillReferences replaces the content of linked reference blocks with the
+// title of the document they point to. References that do not resolve keep
+// their raw content and lose their ReferenceID.
+func (b *BlockRepo) backfillReferences(ctx context.Context, blocks []Block) error {
+	idsBySpace := make(map[string][]interface{})
+	for _, block := range blocks {
+		if block.ReferenceID != "" {
+			idsBySpace[block.SpaceID] = append(idsBySpace[block.SpaceID], block.ReferenceID)
+		}
+	}
+
+	titles := make(map[string]string)
+	for _, space := range b.spaces {
+		ids := idsBySpace[space.ID]
+		if len(ids) == 0 {
+			continue
+		}
+
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = "?" + strconv.Itoa(i+1)
+		}
+
+		query := `select c0 as id, c1 as content from ` + b.contentTableExpr(ctx, space) + ` where c3 = 'document' and c0 in (` + strings.Join(placeholders, ", ") + ")"
+		rows, err := space.DB.QueryContext(ctx, query, ids...)
+		if err != nil {
+			return types.NewError("failed to query referenced documents", err)
+		}
+
+		for rows.Next() {
+			var id string
+			var title sql.NullString
+
+			if err = rows.Scan(&id, &title); err != nil {
+				_ = rows.Close()
+				return types.NewError("failed to scan row", err)
+			}
+
+			if title.Valid && strings.TrimSpace(title.String) != "" {
+				titles[DocumentKey(space.ID, id)] = plainContent(title.String)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return types.NewError("error in rows", err)
+		}
+
+		if err = rows.Close(); err != nil {
+			return types.NewError("closing rows failed", err)
+		}
+	}
+
+	for i, block := range blocks {
+		if block.ReferenceID == "" {
+			continue
+		}
+		if title, ok := titles[DocumentKey(block.SpaceID, block.ReferenceID)]; ok {
+			blocks[i].Content = title
+		} else {
+			// Shown as the raw content it is
+			log.Printf("Reference %s of block %s did not resolve", block.ReferenceID, block.ID)
+			blocks[i].ReferenceID = ""
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+const testReferenceID = "0B7E2A34-1C5D-4E8F-9A01-23456789ABCD"
+
+func TestReferencedID(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{testReferenceID, testReferenceID},
+		{" @" + testReferenceID + " ", testReferenceID},
+		{"[[" + testReferenceID + "]]", testReferenceID},
+		{"craftdocs://open?blockId=" + testReferenceID + "&spaceId=s1", testReferenceID},
+		{"see " + testReferenceID, ""},
+		{"road map", ""},
+		{"0B7E2A34-1C5D-4E8F-9A01", ""},
+	}
+
+	for _, tt := range tests {
+		if got := referencedID(tt.content); got != tt.want {
+			t.Errorf("referencedID(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestBackfillReferences(t *testing.T) {
+	const unknownID = "FFFFFFFF-1C5D-4E8F-9A01-23456789ABCD"
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		document(testReferenceID, "Road Map"),
+		document("doc1", "Plan"),
+		block("ref", "[["+testReferenceID+"]]", "doc1"),
+		block("stale", "@"+unknownID, "doc1"),
+		block("text", "plain text", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", DocumentID: "doc1"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if blocks, err = repo.BackfillDocumentNames(context.Background(), blocks, map[string]struct{}{"s1": {}}); err != nil {
+		t.Fatalf("BackfillDocumentNames() error = %v", err)
+	}
+
+	byID := make(map[string]Block)
+	for _, block := range blocks {
+		byID[block.ID] = block
+	}
+
+	if ref := byID["ref"]; ref.Content != "Road Map" || ref.ReferenceID != testReferenceID {
+		t.Errorf("reference = %q to %q, want the title of the referenced document", ref.Content, ref.ReferenceID)
+	}
+	if stale := byID["stale"]; stale.Content != "@"+unknownID || stale.ReferenceID != "" {
+		t.Errorf("unresolved reference = %q to %q, want the raw content", stale.Content, stale.ReferenceID)
+	}
+	if text := byID["text"]; text.Content != "plain text" || text.ReferenceID != "" {
+		t.Errorf("text block = %q to %q, want it untouched", text.Content, text.ReferenceID)
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/types"
+)
+
+// regexBatchSize is the number of candidate blocks read from a space at a
+// time. The regular expression is applied in Go, so the candidates are read
+// in batches until the space is exhausted rather than all at once.
+var regexBatchSize = 5000
+
+// searchRegex finds the blocks whose content matches the regular expression
+// of opts.Regex. The literal prefix of the expression, if any, narrows the
+// candidates with LIKE; the expression itself is applied in Go. Without a
+// literal prefix, such as for "[Rr]oad", every block of the scope is read.
+// Documents lead, otherwise the index order is kept.
+func (b *BlockRepo) searchRegex(ctx context.Context, spaces []Space, opts SearchOptions, timedOut map[string]bool) ([]Block, error) {
+	re, err := regexp.Compile(opts.Regex)
+	if err != nil {
+		return nil, types.NewError("Invalid regular expression", err)
+	}
+
+	var terms []string
+	if prefix, _ := re.LiteralPrefix(); prefix != "" {
+		terms = []string{prefix}
+	}
+
+	candidateOpts := opts
+	candidateOpts.RawMatch = true
+	candidateOpts.regexScan = true
+
+	var matched []Block
+	for _, space := range spaces {
+		spaceMatches, err := b.scanRegex(ctx, space, re, terms, candidateOpts)
+		if errors.Is(err, errSpaceTimeout) {
+			log.Printf("Regex candidates query on %s timed out", space.ID)
+			timedOut[space.ID] = true
+			continue
+		}
+		if err != nil {
+			return nil, types.NewError("failed to query regex candidates", err)
+		}
+		matched = append(matched, spaceMatches...)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].IsDocument() && !matched[j].IsDocument()
+	})
+
+	return b.filterDateTitles(matched, opts.Daily, opts.ResultLimit), nil
+}
+
+// scanRegex reads the candidate blocks of the space in batches of
+// regexBatchSize and returns those matching the regular expression.
+func (b *BlockRepo) scanRegex(ctx context.Context, space Space, re *regexp.Regexp, terms []string, opts SearchOptions) ([]Block, error) {
+	var matched []Block
+	for opts.offset = 0; ; opts.offset += regexBatchSize {
+		blocks, err := b.queryBlocks(ctx, space, terms, opts, regexBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range blocks {
+			found := re.FindString(block.Content)
+			if found == "" && !re.MatchString(block.Content) {
+				continue
+			}
+			block.Match = Match{ExactMatch: true}
+			if found != "" {
+				block.Match.MatchedWords = []string{found}
+			}
+			matched = append(matched, block)
+		}
+
+		if len(blocks) < regexBatchSize {
+			return matched, nil
+		}
+	}
+}
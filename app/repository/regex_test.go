@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSearchRegexInvalid(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1", block("b1", "road trip", "doc1")))
+
+	if _, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", Regex: "road("}); err == nil {
+		t.Error("Search() error = nil, want the invalid expression reported")
+	}
+}
+
+func TestSearchRegexLiteralPrefix(t *testing.T) {
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b1", "road trip", "doc1"),
+		block("b2", "roadmap", "doc1"),
+		block("b3", "side road", "doc1"),
+	))
+
+	tests := []struct {
+		name, regex string
+		like        bool // whether the candidates are narrowed with LIKE
+		want        []string
+	}{
+		{name: "literal prefix", regex: "road ?t", like: true, want: []string{"b1"}},
+		{name: "no literal", regex: "(side|map)", want: []string{"b2", "b3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", Regex: tt.regex})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			var ids []string
+			for _, block := range blocks {
+				ids = append(ids, block.ID)
+			}
+			if !equalStrings(ids, tt.want) {
+				t.Errorf("Search() = %v, want %v", ids, tt.want)
+			}
+			if like := strings.Contains(logs.String(), "c1 LIKE ?"); like != tt.like {
+				t.Errorf("candidates narrowed with LIKE = %t, want %t", like, tt.like)
+			}
+		})
+	}
+}
+
+func TestSearchRegexBatches(t *testing.T) {
+	old := regexBatchSize
+	regexBatchSize = 2
+	t.Cleanup(func() { regexBatchSize = old })
+
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "partial last batch", count: 5},
+		{name: "full last batch", count: 4},
+		{name: "single batch", count: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows, want []testRow
+			for i := 0; i < tt.count; i++ {
+				rows = append(rows, block(fmt.Sprintf("miss%d", i), "nothing here", "doc1"))
+				match := block(fmt.Sprintf("b%d", i), fmt.Sprintf("task %d done", i), "doc1")
+				rows = append(rows, match)
+				want = append(want, match)
+			}
+			repo := NewBlockRepo(newTestSpace(t, "s1", rows...))
+
+			blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", Regex: `\d done`})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if len(blocks) != len(want) {
+				t.Fatalf("Search() = %v, want %d blocks", keys(blocks), len(want))
+			}
+			for i, block := range blocks {
+				if block.ID != want[i].ID {
+					t.Errorf("result %d = %s, want %s", i, block.ID, want[i].ID)
+				}
+				if words := block.Match.MatchedWords; len(words) != 1 || words[0] != fmt.Sprintf("%d done", i) {
+					t.Errorf("result %d matched %q, want the match of the expression", i, words)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRegexResultLimit(t *testing.T) {
+	old := regexBatchSize
+	regexBatchSize = 2
+	t.Cleanup(func() { regexBatchSize = old })
+
+	repo := NewBlockRepo(newTestSpace(t, "s1",
+		block("b1", "road one", "doc1"),
+		block("b2", "road two", "doc1"),
+		block("b3", "road three", "doc1"),
+		document("doc1", "Road trips"),
+		block("b4", "road four", "doc1"),
+	))
+
+	blocks, err := repo.Search(context.Background(), nil, SearchOptions{CurrentSpaceID: "s1", Regex: "(?i)road", ResultLimit: 3})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	var ids []string
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	if want := []string{"doc1", "b1", "b2"}; !equalStrings(ids, want) {
+		t.Errorf("Search() = %v, want the document first and %d results in all", ids, len(want))
+	}
+}
@@ -3,12 +3,21 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
 )
 
 type BlockService struct {
-	br *repository.BlockRepo
+	br       *repository.BlockRepo
+	backfill time.Duration // document name backfill of the last search
+}
+
+// Timings are the durations of the phases of a search.
+type Timings struct {
+	repository.SearchTimings
+	Backfill time.Duration // resolving the document names of the results
 }
 
 func (bs *BlockService) Close() error {
@@ -19,8 +28,43 @@ func NewBlockService(br *repository.BlockRepo) *BlockService {
 	return &BlockService{br: br}
 }
 
-func (r *BlockService) Search(ctx context.Context, args []string, allSpaces bool, daily bool, currentSpaceID string) ([]repository.Block, error) {
-	blocks, err := r.br.Search(ctx, args, allSpaces, daily, currentSpaceID)
+// normalizeTerms trims every term and drops the empty ones, so a query made of
+// whitespace only is treated as an empty query.
+func normalizeTerms(args []string) []string {
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		if term := strings.TrimSpace(arg); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// dedupeTerms drops repeated terms, compared case-insensitively, keeping the
+// first occurrence of each.
+func dedupeTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	deduped := make([]string, 0, len(terms))
+	for _, term := range terms {
+		key := strings.ToLower(term)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, term)
+	}
+	return deduped
+}
+
+func (r *BlockService) Search(ctx context.Context, args []string, opts repository.SearchOptions) ([]repository.Block, error) {
+	terms := normalizeTerms(args)
+	deduped := dedupeTerms(terms)
+	if len(deduped) < len(terms) {
+		// Repeated words still count for the exact phrase
+		opts.Phrase = strings.Join(terms, " ")
+	}
+
+	blocks, err := r.br.Search(ctx, deduped, opts)
 	if err != nil {
 		return nil, fmt.Errorf("search: %w", err)
 	}
@@ -30,10 +74,83 @@ func (r *BlockService) Search(ctx context.Context, args []string, allSpaces bool
 		targetSpaceIDs[block.SpaceID] = struct{}{}
 	}
 
+	backfillStart := time.Now()
 	blocks, err = r.br.BackfillDocumentNames(ctx, blocks, targetSpaceIDs)
+	r.backfill = time.Since(backfillStart)
 	if err != nil {
 		return nil, fmt.Errorf("backfill document names: %w", err)
 	}
 
 	return blocks, nil
 }
+
+// Timings returns the phase durations of the last search.
+func (r *BlockService) Timings() Timings {
+	return Timings{SearchTimings: r.br.Timings(), Backfill: r.backfill}
+}
+
+// ExcludeDocument drops the document from the results, and its blocks as
+// well when withBlocks is set.
+func ExcludeDocument(blocks []repository.Block, documentID string, withBlocks bool) []repository.Block {
+	kept := make([]repository.Block, 0, len(blocks))
+	for _, block := range blocks {
+		if block.DocumentID == documentID && (block.IsDocument() || withBlocks) {
+			continue
+		}
+		kept = append(kept, block)
+	}
+	return kept
+}
+
+// DropTitleDuplicates drops the blocks repeating the title of their document,
+// such as a title block, as the document already stands for them. With fold,
+// diacritics are ignored as in the search.
+func DropTitleDuplicates(blocks []repository.Block, fold bool) []repository.Block {
+	kept := make([]repository.Block, 0, len(blocks))
+	for _, block := range blocks {
+		title, content := strings.TrimSpace(block.DocumentTitle), strings.TrimSpace(block.Content)
+		if fold {
+			title, content = repository.FoldDiacritics(title), repository.FoldDiacritics(content)
+		}
+		if !block.IsDocument() && title != "" && strings.EqualFold(content, title) {
+			continue
+		}
+		kept = append(kept, block)
+	}
+	return kept
+}
+
+// TimedOutSpaces returns the spaces the last search gave up on.
+func (r *BlockService) TimedOutSpaces() []string {
+	return r.br.TimedOutSpaces()
+}
+
+// UseDocumentTitles makes searches take the titles of the given documents,
+// keyed by repository.DocumentKey, instead of reading them from the index.
+func (r *BlockService) UseDocumentTitles(titles map[string]string) {
+	r.br.WithDocumentTitles(titles)
+}
+
+// BackfillHeadings sets the heading each block is under, when it has one.
+func (r *BlockService) BackfillHeadings(ctx context.Context, blocks []repository.Block) error {
+	if err := r.br.BackfillHeadings(ctx, blocks); err != nil {
+		return fmt.Errorf("backfill headings: %w", err)
+	}
+	return nil
+}
+
+// BlockContext returns the block's content surrounded by up to window sibling
+// blocks on each side, one block per line.
+func (r *BlockService) BlockContext(ctx context.Context, block repository.Block, window int) (string, error) {
+	blocks, err := r.br.SurroundingBlocks(ctx, block, window)
+	if err != nil {
+		return "", fmt.Errorf("surrounding blocks: %w", err)
+	}
+
+	lines := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		lines = append(lines, b.Content)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
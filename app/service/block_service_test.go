@@ -0,0 +1,102 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+// ids returns the IDs of the blocks, in order.
+func ids(blocks []repository.Block) []string {
+	ids := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	return ids
+}
+
+func TestNormalizeTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "spaces only", args: []string{"   "}, want: []string{}},
+		{name: "padded terms", args: []string{" a ", "  ", "b "}, want: []string{"a", "b"}},
+		{name: "tabs", args: []string{"\ta\t", "\t", "b"}, want: []string{"a", "b"}},
+		{name: "none", args: nil, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTerms(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTerms(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludeDocument(t *testing.T) {
+	blocks := []repository.Block{
+		{ID: "doc1", DocumentID: "doc1", EntityType: "document"},
+		{ID: "b1", DocumentID: "doc1"},
+		{ID: "doc2", DocumentID: "doc2", EntityType: "document"},
+		{ID: "b2", DocumentID: "doc2"},
+	}
+
+	tests := []struct {
+		name       string
+		documentID string
+		withBlocks bool
+		want       []string
+	}{
+		{name: "document only", documentID: "doc1", want: []string{"b1", "doc2", "b2"}},
+		{name: "with its blocks", documentID: "doc1", withBlocks: true, want: []string{"doc2", "b2"}},
+		{name: "unknown document", documentID: "doc3", withBlocks: true, want: []string{"doc1", "b1", "doc2", "b2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(ExcludeDocument(blocks, tt.documentID, tt.withBlocks)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExcludeDocument() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeTerms(t *testing.T) {
+	tests := []struct {
+		terms []string
+		want  []string
+	}{
+		{[]string{"plan", "plan", "plan"}, []string{"plan"}},
+		{[]string{"Plan", "road", "PLAN", "map", "road"}, []string{"Plan", "road", "map"}},
+		{[]string{"road", "map"}, []string{"road", "map"}},
+	}
+
+	for _, tt := range tests {
+		if got := dedupeTerms(tt.terms); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dedupeTerms(%q) = %q, want %q", tt.terms, got, tt.want)
+		}
+	}
+}
+
+func TestDropTitleDuplicates(t *testing.T) {
+	blocks := []repository.Block{
+		{ID: "doc1", DocumentID: "doc1", EntityType: "document", Content: "Road Map", DocumentTitle: "Road Map"},
+		{ID: "b1", DocumentID: "doc1", Content: " road map ", DocumentTitle: "Road Map"},
+		{ID: "b2", DocumentID: "doc1", Content: "road map details", DocumentTitle: "Road Map"},
+		{ID: "doc2", DocumentID: "doc2", EntityType: "document", Content: "Café", DocumentTitle: "Café"},
+		{ID: "b3", DocumentID: "doc2", Content: "Cafe", DocumentTitle: "Café"},
+		{ID: "b4", Content: "orphan"},
+	}
+
+	// The title block goes, the document and other blocks stay
+	if got, want := ids(DropTitleDuplicates(blocks, false)), []string{"doc1", "b2", "doc2", "b3", "b4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DropTitleDuplicates() = %v, want %v", got, want)
+	}
+	if got, want := ids(DropTitleDuplicates(blocks, true)), []string{"doc1", "b2", "doc2", "b4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DropTitleDuplicates() folding diacritics = %v, want %v", got, want)
+	}
+}
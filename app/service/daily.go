@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+// ParseDateRange reads the range of a `daily:` token relative to now. The
+// range starts at from and ends before to. Supported forms are `today`,
+// `yesterday`, `lastN` for the last N days including today, and a year,
+// month or day such as `2024`, `2024-01` or `2024-01-05`.
+func ParseDateRange(value string, now time.Time) (time.Time, time.Time, error) {
+	value = strings.ToLower(value)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch value {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	}
+
+	if strings.HasPrefix(value, "last") {
+		days, err := strconv.Atoi(strings.TrimPrefix(value, "last"))
+		if err != nil || days <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid number of days in %q", value)
+		}
+		return today.AddDate(0, 0, 1-days), today.AddDate(0, 0, 1), nil
+	}
+
+	layouts := []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{layout: "2006", years: 1},
+		{layout: "2006-01", months: 1},
+		{layout: "2006-01-02", days: 1},
+	}
+	for _, l := range layouts {
+		if len(value) != len(l.layout) {
+			continue
+		}
+		if from, err := time.ParseInLocation(l.layout, value, now.Location()); err == nil {
+			return from, from.AddDate(l.years, l.months, l.days), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown date range %q", value)
+}
+
+// DailyNotes lists the daily notes within the `daily:` range, oldest first.
+func (r *BlockService) DailyNotes(ctx context.Context, dateRange string, opts repository.SearchOptions) ([]repository.Block, error) {
+	from, to, err := ParseDateRange(dateRange, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("parse date range: %w", err)
+	}
+
+	blocks, err := r.br.DailyNotes(ctx, from, to, opts)
+	if err != nil {
+		return nil, fmt.Errorf("daily notes: %w", err)
+	}
+
+	targetSpaceIDs := make(map[string]struct{})
+	for _, block := range blocks {
+		targetSpaceIDs[block.SpaceID] = struct{}{}
+	}
+
+	blocks, err = r.br.BackfillDocumentNames(ctx, blocks, targetSpaceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("backfill document names: %w", err)
+	}
+
+	return blocks, nil
+}
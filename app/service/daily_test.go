@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	now := time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		value    string
+		from, to time.Time
+	}{
+		{"today", day(2024, 3, 15), day(2024, 3, 16)},
+		{"yesterday", day(2024, 3, 14), day(2024, 3, 15)},
+		{"last7", day(2024, 3, 9), day(2024, 3, 16)},
+		{"Last1", day(2024, 3, 15), day(2024, 3, 16)},
+		{"2024", day(2024, 1, 1), day(2025, 1, 1)},
+		{"2024-01", day(2024, 1, 1), day(2024, 2, 1)},
+		{"2024-02-29", day(2024, 2, 29), day(2024, 3, 1)},
+	}
+
+	for _, tt := range tests {
+		from, to, err := ParseDateRange(tt.value, now)
+		if err != nil {
+			t.Errorf("ParseDateRange(%q) error = %v", tt.value, err)
+			continue
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("ParseDateRange(%q) = %v, %v, want %v, %v", tt.value, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestParseDateRangeInvalid(t *testing.T) {
+	for _, value := range []string{"", "last", "last0", "last-3", "lastweek", "2024-13", "2024-1", "24", "tomorrow"} {
+		if _, _, err := ParseDateRange(value, time.Now()); err == nil {
+			t.Errorf("ParseDateRange(%q) error = nil, want an error", value)
+		}
+	}
+}
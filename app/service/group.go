@@ -0,0 +1,107 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+// DocumentGroup collects the matching blocks of one document.
+type DocumentGroup struct {
+	SpaceID    string
+	DocumentID string
+	Title      string
+	Blocks     []repository.Block
+	MatchCount int // number of the document's blocks that matched
+}
+
+// GroupByDocument collapses blocks under their documents. Groups keep the
+// order in which their first block appears in the results.
+func GroupByDocument(blocks []repository.Block) []DocumentGroup {
+	var groups []DocumentGroup
+	index := make(map[string]int)
+
+	for _, block := range blocks {
+		key := repository.DocumentKey(block.SpaceID, block.DocumentID)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, DocumentGroup{
+				SpaceID:    block.SpaceID,
+				DocumentID: block.DocumentID,
+				Title:      block.DocumentTitle,
+			})
+		}
+
+		groups[i].Blocks = append(groups[i].Blocks, block)
+		groups[i].MatchCount++
+	}
+
+	return groups
+}
+
+// RankGroups orders the groups by the match tier of their best block, and
+// groups of the same tier by how many of their blocks matched. Groups equal
+// on both keep their order.
+func RankGroups(groups []DocumentGroup) []DocumentGroup {
+	ranked := make([]DocumentGroup, len(groups))
+	copy(ranked, groups)
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		// The first block of a group is its best, blocks keep the result order
+		ti, tj := matchTier(ranked[i].Blocks[0].Match), matchTier(ranked[j].Blocks[0].Match)
+		if ti != tj {
+			return ti > tj
+		}
+		return ranked[i].MatchCount > ranked[j].MatchCount
+	})
+
+	return ranked
+}
+
+// ClusterByDocument keeps the blocks of a document next to each other within
+// every match tier, ordering the documents by title. The tiers keep their
+// order, so a better match never moves below a worse one.
+func ClusterByDocument(blocks []repository.Block) []repository.Block {
+	clustered := make([]repository.Block, len(blocks))
+	copy(clustered, blocks)
+
+	for start := 0; start < len(clustered); {
+		end := start + 1
+		for end < len(clustered) && matchTier(clustered[end].Match) == matchTier(clustered[start].Match) {
+			end++
+		}
+
+		tier := clustered[start:end]
+		sort.SliceStable(tier, func(i, j int) bool {
+			return strings.ToLower(tier[i].DocumentTitle) < strings.ToLower(tier[j].DocumentTitle)
+		})
+
+		start = end
+	}
+
+	return clustered
+}
+
+// matchTier ranks how well a block matched, following the order of the match
+// tiers of the search. Higher is better.
+func matchTier(m repository.Match) int {
+	switch {
+	case m.EqualMatch:
+		return 6
+	case m.TagMatch:
+		return 5
+	case m.ExactMatch:
+		return 4
+	case m.OrderedWordsMatch:
+		return 3
+	case m.AllWordsMatch:
+		return 2
+	case m.JoinedMatch, m.Acronym, m.Subsequence:
+		return 1
+	}
+	return 0
+}
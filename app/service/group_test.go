@@ -0,0 +1,118 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+func TestGroupByDocumentCounts(t *testing.T) {
+	blocks := []repository.Block{
+		{ID: "b1", SpaceID: "s1", DocumentID: "doc1", DocumentTitle: "Plan"},
+		{ID: "b2", SpaceID: "s1", DocumentID: "doc2", DocumentTitle: "Notes"},
+		{ID: "b3", SpaceID: "s1", DocumentID: "doc1", DocumentTitle: "Plan"},
+		{ID: "b4", SpaceID: "s2", DocumentID: "doc1", DocumentTitle: "Plan"},
+		{ID: "b5", SpaceID: "s1", DocumentID: "doc1", DocumentTitle: "Plan"},
+	}
+
+	groups := GroupByDocument(blocks)
+
+	want := []struct {
+		spaceID, documentID string
+		count               int
+		ids                 []string
+	}{
+		{"s1", "doc1", 3, []string{"b1", "b3", "b5"}},
+		{"s1", "doc2", 1, []string{"b2"}},
+		{"s2", "doc1", 1, []string{"b4"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.SpaceID != w.spaceID || g.DocumentID != w.documentID {
+			t.Errorf("group %d is %s/%s, want %s/%s", i, g.SpaceID, g.DocumentID, w.spaceID, w.documentID)
+		}
+		if g.MatchCount != w.count || len(g.Blocks) != w.count {
+			t.Errorf("group %d counts %d matches in %d blocks, want %d", i, g.MatchCount, len(g.Blocks), w.count)
+		}
+		for j, id := range w.ids {
+			if j < len(g.Blocks) && g.Blocks[j].ID != id {
+				t.Errorf("group %d block %d = %s, want %s", i, j, g.Blocks[j].ID, id)
+			}
+		}
+	}
+}
+
+func TestRankGroups(t *testing.T) {
+	groups := []DocumentGroup{
+		{DocumentID: "partial", MatchCount: 5, Blocks: []repository.Block{{Match: repository.Match{MatchedWords: []string{"a"}}}}},
+		{DocumentID: "exact-one", MatchCount: 1, Blocks: []repository.Block{{Match: repository.Match{ExactMatch: true}}}},
+		{DocumentID: "exact-two", MatchCount: 2, Blocks: []repository.Block{{Match: repository.Match{ExactMatch: true}}}},
+	}
+
+	ranked := RankGroups(groups)
+
+	want := []string{"exact-two", "exact-one", "partial"}
+	for i, id := range want {
+		if ranked[i].DocumentID != id {
+			t.Errorf("rank %d = %s, want %s", i, ranked[i].DocumentID, id)
+		}
+	}
+	if groups[0].DocumentID != "partial" {
+		t.Error("RankGroups() reordered its input")
+	}
+}
+
+func TestClusterByDocument(t *testing.T) {
+	exact := repository.Match{ExactMatch: true}
+	allWords := repository.Match{AllWordsMatch: true}
+	blocks := []repository.Block{
+		{ID: "b1", DocumentID: "doc2", DocumentTitle: "Travel", Match: exact},
+		{ID: "b2", DocumentID: "doc1", DocumentTitle: "plan", Match: exact},
+		{ID: "b3", DocumentID: "doc2", DocumentTitle: "Travel", Match: exact},
+		{ID: "b4", DocumentID: "doc1", DocumentTitle: "plan", Match: exact},
+		{ID: "b5", DocumentID: "doc2", DocumentTitle: "Travel", Match: allWords},
+		{ID: "b6", DocumentID: "doc1", DocumentTitle: "plan", Match: allWords},
+	}
+
+	clustered := ClusterByDocument(blocks)
+
+	// Documents cluster by title within a tier, the tiers keep their order
+	// and blocks keep their order within a document
+	want := []string{"b2", "b4", "b1", "b3", "b6", "b5"}
+	if got := ids(clustered); !reflect.DeepEqual(got, want) {
+		t.Errorf("ClusterByDocument() = %v, want %v", got, want)
+	}
+	if got := ids(blocks); !reflect.DeepEqual(got, []string{"b1", "b2", "b3", "b4", "b5", "b6"}) {
+		t.Errorf("ClusterByDocument() reordered the blocks passed in: %v", got)
+	}
+}
+
+func TestRankGroupsByMatchCount(t *testing.T) {
+	allWords := repository.Match{AllWordsMatch: true}
+	blocks := []repository.Block{
+		{ID: "b1", SpaceID: "s1", DocumentID: "few", Match: allWords},
+		{ID: "b2", SpaceID: "s1", DocumentID: "tied", Match: allWords},
+		{ID: "b3", SpaceID: "s1", DocumentID: "many", Match: allWords},
+		{ID: "b4", SpaceID: "s1", DocumentID: "many", Match: allWords},
+		{ID: "b5", SpaceID: "s1", DocumentID: "many", Match: allWords},
+		{ID: "b6", SpaceID: "s1", DocumentID: "tied"},
+		{ID: "b7", SpaceID: "s1", DocumentID: "also-tied", Match: allWords},
+		{ID: "b8", SpaceID: "s1", DocumentID: "also-tied", Match: allWords},
+	}
+
+	ranked := RankGroups(GroupByDocument(blocks))
+
+	// At equal match quality more matching blocks rank higher, and equal
+	// counts keep the search order
+	var got []string
+	for _, group := range ranked {
+		got = append(got, group.DocumentID)
+	}
+	if want := []string{"many", "tied", "also-tied", "few"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RankGroups() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"strings"
+)
+
+// tokenKeys lists the `key:value` query tokens that are recognized. Any other
+// term containing a colon is searched for as is.
+var tokenKeys = map[string]bool{
+	"space":  true,
+	"doc":    true,
+	"star":   true,
+	"folder": true,
+	"todo":   true,
+	"daily":  true,
+	"limit":  true,
+	"file":   true,
+}
+
+// Query is a search query split into plain search terms and tokens.
+type Query struct {
+	Terms  []string
+	Tokens map[string]string
+	// Path holds the folder path segments typed as `path:work/projects` or
+	// `/work/projects`, matched in order within the folder the index records
+	// for the documents instead of their content.
+	Path []string
+}
+
+// ParseQuery splits the arguments by whitespace and separates recognized
+// `key:value` tokens from the search terms.
+func ParseQuery(args []string) Query {
+	q := Query{Tokens: make(map[string]string)}
+
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			if key, value, ok := splitToken(field); ok {
+				q.Tokens[key] = value
+				continue
+			}
+			if segments, ok := splitPath(field); ok {
+				q.Path = append(q.Path, segments...)
+				continue
+			}
+			q.Terms = append(q.Terms, field)
+		}
+	}
+
+	return q
+}
+
+// RawQuery keeps the arguments as a single search term, without tokens.
+func RawQuery(args []string) Query {
+	q := Query{Tokens: make(map[string]string)}
+	if raw := strings.Join(args, " "); strings.TrimSpace(raw) != "" {
+		q.Terms = []string{raw}
+	}
+	return q
+}
+
+func splitToken(field string) (string, string, bool) {
+	i := strings.Index(field, ":")
+	if i <= 0 || i == len(field)-1 {
+		return "", "", false
+	}
+
+	key := strings.ToLower(field[:i])
+	if !tokenKeys[key] {
+		return "", "", false
+	}
+
+	return key, field[i+1:], true
+}
+
+// pathKey is the token that holds a folder path, as in `path:work/projects`.
+const pathKey = "path:"
+
+// splitPath splits a folder path into its segments. A path is typed as
+// `path:work/projects` or with a leading slash, `/work/projects`; other terms
+// with slashes, such as `TCP/IP` or `24/7`, are searched for as they are.
+func splitPath(field string) ([]string, bool) {
+	var path string
+	switch {
+	case len(field) > len(pathKey) && strings.EqualFold(field[:len(pathKey)], pathKey):
+		path = field[len(pathKey):]
+	case strings.HasPrefix(field, "/"):
+		path = field
+	default:
+		return nil, false
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments, len(segments) > 0
+}
+
+// Flag reports whether a boolean token is set to a truthy value such as
+// `star:yes`.
+func (q Query) Flag(key string) bool {
+	value, ok := q.Tokens[key]
+	if !ok {
+		return false
+	}
+
+	switch strings.ToLower(value) {
+	case "0", "n", "no", "off", "false":
+		return false
+	}
+	return true
+}
+
+// TokenOnly reports whether the query consists of tokens only. Such a query
+// only narrows the scope, so it browses instead of searching.
+func (q Query) TokenOnly() bool {
+	return len(q.Terms) == 0 && (len(q.Tokens) > 0 || len(q.Path) > 0)
+}
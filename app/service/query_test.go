@@ -0,0 +1,146 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryWhitespace(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "spaces only", query: "   ", want: nil},
+		{name: "padded words", query: " a  b ", want: []string{"a", "b"}},
+		{name: "tabs", query: "\ta\t\tb\t", want: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseQuery([]string{tt.query}).Terms; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q).Terms = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawQueryWhitespace(t *testing.T) {
+	if got := RawQuery([]string{" \t "}).Terms; got != nil {
+		t.Errorf("RawQuery() of whitespace = %q, want no terms", got)
+	}
+}
+
+func TestQueryTokenOnly(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"space:work", true},
+		{"space:work star:yes", true},
+		{"/work/projects", true},
+		{"space:work plan", false},
+		{"plan", false},
+		{"", false},
+		{"unknown:token", false},
+	}
+
+	for _, tt := range tests {
+		q := ParseQuery([]string{tt.query})
+		if got := q.TokenOnly(); got != tt.want {
+			t.Errorf("ParseQuery(%q).TokenOnly() = %t, want %t", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryTokensOnly(t *testing.T) {
+	q := ParseQuery([]string{"space:work", "doc:abc"})
+
+	if len(q.Terms) != 0 {
+		t.Errorf("Terms = %q, want none left to name a document", q.Terms)
+	}
+	if q.Tokens["space"] != "work" || q.Tokens["doc"] != "abc" {
+		t.Errorf("Tokens = %v", q.Tokens)
+	}
+}
+
+func TestRawQueryKeepsMarkdown(t *testing.T) {
+	q := RawQuery([]string{"- [ ] buy", "#tag"})
+
+	if want := []string{"- [ ] buy #tag"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want the query as a single term %q", q.Terms, want)
+	}
+	if len(q.Tokens) != 0 {
+		t.Errorf("Tokens = %v, want none", q.Tokens)
+	}
+}
+
+func TestParseQueryTodoToken(t *testing.T) {
+	q := ParseQuery([]string{"todo:open buy milk"})
+
+	if q.Tokens["todo"] != "open" {
+		t.Errorf("todo token = %q, want open", q.Tokens["todo"])
+	}
+	if want := []string{"buy", "milk"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want the token stripped %q", q.Terms, want)
+	}
+}
+
+func TestParseQueryFolderToken(t *testing.T) {
+	q := ParseQuery([]string{"folder:f1 road map"})
+
+	if q.Tokens["folder"] != "f1" {
+		t.Errorf("folder token = %q, want f1", q.Tokens["folder"])
+	}
+	if want := []string{"road", "map"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want the token stripped %q", q.Terms, want)
+	}
+}
+
+func TestParseQueryLimitToken(t *testing.T) {
+	q := ParseQuery([]string{"limit:10", "meeting notes"})
+
+	if q.Tokens["limit"] != "10" {
+		t.Errorf("limit token = %q, want 10", q.Tokens["limit"])
+	}
+	if want := []string{"meeting", "notes"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want the token stripped %q", q.Terms, want)
+	}
+}
+
+func TestParseQueryPath(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantPath  []string
+		wantTerms []string
+	}{
+		{query: "path:work/projects plan", wantPath: []string{"work", "projects"}, wantTerms: []string{"plan"}},
+		{query: "PATH:work plan", wantPath: []string{"work"}, wantTerms: []string{"plan"}},
+		{query: "/work/projects/ plan", wantPath: []string{"work", "projects"}, wantTerms: []string{"plan"}},
+		{query: "TCP/IP 24/7", wantTerms: []string{"TCP/IP", "24/7"}},
+		{query: "https://craft.do/s/abc", wantTerms: []string{"https://craft.do/s/abc"}},
+		{query: "/ plan", wantTerms: []string{"/", "plan"}},
+	}
+
+	for _, tt := range tests {
+		q := ParseQuery([]string{tt.query})
+		if !reflect.DeepEqual(q.Path, tt.wantPath) || !reflect.DeepEqual(q.Terms, tt.wantTerms) {
+			t.Errorf("ParseQuery(%q) path %q, terms %q, want %q, %q", tt.query, q.Path, q.Terms, tt.wantPath, tt.wantTerms)
+		}
+	}
+
+	if q := ParseQuery([]string{"path:work"}); !q.TokenOnly() {
+		t.Error("TokenOnly() of a path alone = false, want it to browse the folder")
+	}
+}
+
+func TestParseQueryFileToken(t *testing.T) {
+	q := ParseQuery([]string{"file:report.pdf q3"})
+
+	if q.Tokens["file"] != "report.pdf" {
+		t.Errorf("file token = %q, want report.pdf", q.Tokens["file"])
+	}
+	if want := []string{"q3"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want %q", q.Terms, want)
+	}
+}
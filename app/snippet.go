@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Snippet modes of the SNIPPET config.
+const (
+	snippetWindow   = "window"
+	snippetSentence = "sentence"
+)
+
+// snippetRadius is the number of characters a window snippet keeps on each
+// side of the match.
+const snippetRadius = 60
+
+// snippet cuts the content down to the first match of the words. The
+// sentence mode falls back to the window when no sentence boundary sets the
+// match apart. Content without a match is returned unchanged.
+func snippet(content string, words []string, mode string) string {
+	if mode != snippetWindow && mode != snippetSentence {
+		return content
+	}
+
+	runes := []rune(content)
+	start, end := firstMatch(runes, words)
+	if start < 0 {
+		return content
+	}
+
+	if mode == snippetSentence {
+		if from, to, ok := sentenceAround(runes, start, end); ok {
+			return strings.TrimSpace(string(runes[from:to]))
+		}
+	}
+
+	from, to := start-snippetRadius, end+snippetRadius
+	prefix, suffix := "…", "…"
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	if to >= len(runes) {
+		to, suffix = len(runes), ""
+	}
+
+	return prefix + strings.TrimSpace(string(runes[from:to])) + suffix
+}
+
+// firstMatch returns the rune range of the earliest case-insensitive match of
+// any of the words, or -1 when none matches.
+func firstMatch(runes []rune, words []string) (int, int) {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	start, end := -1, -1
+	for _, word := range words {
+		needle := []rune(strings.ToLower(word))
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower) && (start < 0 || i < start); i++ {
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				start, end = i, i+len(needle)
+				break
+			}
+		}
+	}
+
+	return start, end
+}
+
+// isSentenceEnd reports whether the rune ends a sentence.
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '\n'
+}
+
+// sentenceAround returns the range of the sentence holding the match, from
+// after the previous boundary through the next one. It reports false when
+// there is no boundary on either side, as the sentence is then the whole
+// content.
+func sentenceAround(runes []rune, start, end int) (int, int, bool) {
+	from := start
+	for from > 0 && !isSentenceEnd(runes[from-1]) {
+		from--
+	}
+
+	to := end
+	for to < len(runes) && !isSentenceEnd(runes[to]) {
+		to++
+	}
+	if to < len(runes) {
+		to++ // keep the punctuation
+	}
+
+	return from, to, from > 0 || to < len(runes)
+}
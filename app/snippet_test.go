@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippetSentence(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		words   []string
+		want    string
+	}{
+		{name: "middle sentence", content: "First one. The Road map is here! Last?", words: []string{"road"}, want: "The Road map is here!"},
+		{name: "first sentence", content: "Road map first. Then more.", words: []string{"map"}, want: "Road map first."},
+		{name: "last sentence", content: "Intro here. Ends with the road", words: []string{"road"}, want: "Ends with the road"},
+		{name: "line break", content: "Heading\nthe road map\nfooter", words: []string{"road"}, want: "the road map"},
+		{name: "earliest word", content: "A map. A road.", words: []string{"road", "map"}, want: "A map."},
+		{name: "no match", content: "Nothing. Here.", words: []string{"road"}, want: "Nothing. Here."},
+	}
+
+	for _, tt := range tests {
+		if got := snippet(tt.content, tt.words, snippetSentence); got != tt.want {
+			t.Errorf("%s: snippet() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetSentenceWithoutBoundary(t *testing.T) {
+	content := strings.Repeat("word ", 20) + "road " + strings.Repeat("word ", 20)
+
+	// The whole content is one sentence, the window is shorter
+	got := snippet(content, []string{"road"}, snippetSentence)
+	if want := snippet(content, []string{"road"}, snippetWindow); got != want || !strings.HasPrefix(got, "…") {
+		t.Errorf("snippet() = %q, want the window %q", got, want)
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	content := strings.Repeat("a", 100) + " road " + strings.Repeat("b", 100)
+
+	got := snippet(content, []string{"road"}, snippetWindow)
+
+	want := "…" + strings.Repeat("a", snippetRadius-1) + " road " + strings.Repeat("b", snippetRadius-1) + "…"
+	if got != want {
+		t.Errorf("snippet() = %q, want %q", got, want)
+	}
+	if got := snippet("short road", []string{"road"}, snippetWindow); got != "short road" {
+		t.Errorf("snippet() = %q, want short content whole", got)
+	}
+}
+
+func TestSnippetDisabled(t *testing.T) {
+	content := "First one. The road map is here!"
+	if got := snippet(content, []string{"road"}, ""); got != content {
+		t.Errorf("snippet() = %q, want the content unchanged", got)
+	}
+}
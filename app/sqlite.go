@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/config"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+	"github.com/mattn/go-sqlite3"
+)
+
+// readDriver is go-sqlite3 registered with the read PRAGMAs and the SQL
+// functions of the repository set up on every connection, since database/sql
+// may open several per index.
+const readDriver = "sqlite3_read"
+
+var registerReadDriver sync.Once
+
+// readPragmas returns the PRAGMAs tuning a connection for reading the index.
+// The workflow never writes, so query_only is always on. Zero sizes keep the
+// sqlite defaults.
+func readPragmas(cfg *config.Config) []string {
+	pragmas := []string{"PRAGMA query_only = ON"}
+	if cfg.SQLiteCacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d", cfg.SQLiteCacheSize))
+	}
+	if cfg.SQLiteMmapSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA mmap_size = %d", cfg.SQLiteMmapSize))
+	}
+	return pragmas
+}
+
+// openIndex opens the search index at path with the read PRAGMAs of cfg.
+func openIndex(cfg *config.Config, path string) (*sql.DB, error) {
+	registerReadDriver.Do(func() {
+		pragmas := readPragmas(cfg)
+		sql.Register(readDriver, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.RegisterFunc(repository.FoldFunction, repository.FoldDiacritics, true); err != nil {
+					return fmt.Errorf("register %s: %w", repository.FoldFunction, err)
+				}
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("%s: %w", pragma, err)
+					}
+				}
+				return nil
+			},
+		})
+	})
+
+	return sql.Open(readDriver, path)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+func TestReadPragmas(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"PRAGMA query_only = ON", "PRAGMA cache_size = -16384", "PRAGMA mmap_size = 268435456"},
+		},
+		{
+			name: "sqlite defaults kept",
+			vars: map[string]string{"SQLITE_CACHE_SIZE": "0", "SQLITE_MMAP_SIZE": "0"},
+			want: []string{"PRAGMA query_only = ON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readPragmas(newTestConfig(t, tt.vars, "s1")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPragmas() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenIndexPragmas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.sqlite")
+	setup, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = setup.Exec("CREATE TABLE t (c)"); err != nil {
+		t.Fatal(err)
+	}
+	_ = setup.Close()
+
+	db, err := openIndex(newTestConfig(t, nil, "s1"), path)
+	if err != nil {
+		t.Fatalf("openIndex() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	// Hold two connections at once, each must be tuned on its own
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+
+		var queryOnly, cacheSize int
+		if err := conn.QueryRowContext(ctx, "PRAGMA query_only").Scan(&queryOnly); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA cache_size").Scan(&cacheSize); err != nil {
+			t.Fatal(err)
+		}
+		if queryOnly != 1 || cacheSize != -16384 {
+			t.Errorf("connection %d query_only = %d, cache_size = %d, want 1, -16384", i, queryOnly, cacheSize)
+		}
+
+		if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err == nil {
+			t.Errorf("connection %d wrote to the index", i)
+		}
+	}
+}
+
+func TestOpenIndexFoldFunction(t *testing.T) {
+	db, err := openIndex(newTestConfig(t, nil, "s1"), filepath.Join(t.TempDir(), "index.sqlite"))
+	if err != nil {
+		t.Fatalf("openIndex() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	var got string
+	if err := db.QueryRow("SELECT "+repository.FoldFunction+"(?)", "Señor Καλημέρα").Scan(&got); err != nil {
+		t.Fatalf("%s() error = %v", repository.FoldFunction, err)
+	}
+	if want := "senor καλημέρα"; got != want {
+		t.Errorf("%s() = %q, want %q", repository.FoldFunction, got, want)
+	}
+}
@@ -1,14 +1,71 @@
 package types
 
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// Category tells how the user can recover from an error.
+type Category int
+
+const (
+	// Fatal errors are not expected to go away on their own.
+	Fatal Category = iota
+	// Transient errors, such as a locked database, may go away on retry.
+	Transient
+	// Config errors need the workflow setup to be fixed.
+	Config
+)
+
 type Error struct {
-	Title string
-	Err   error
+	Title    string
+	Err      error
+	Category Category
 }
 
 func (e Error) Error() string {
 	return e.Err.Error()
 }
 
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError wraps err with a title and categorizes it by its cause.
 func NewError(title string, err error) Error {
-	return Error{Title: title, Err: err}
+	return Error{Title: title, Err: err, Category: categorize(err)}
+}
+
+// NewConfigError wraps an error caused by the workflow setup.
+func NewConfigError(title string, err error) Error {
+	return Error{Title: title, Err: err, Category: Config}
+}
+
+// NewTransientError wraps an error expected to go away on retry.
+func NewTransientError(title string, err error) Error {
+	return Error{Title: title, Err: err, Category: Transient}
+}
+
+// transientMessages are the SQLite failures that are worth retrying.
+var transientMessages = []string{
+	"database is locked",
+	"database table is locked",
+	"unable to open database file",
+	"interrupted",
+}
+
+func categorize(err error) Category {
+	if errors.Is(err, os.ErrNotExist) {
+		return Transient
+	}
+
+	msg := err.Error()
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return Transient
+		}
+	}
+
+	return Fatal
 }
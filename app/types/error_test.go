@@ -0,0 +1,54 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestNewErrorCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Category
+	}{
+		{name: "locked database", err: errors.New("database is locked"), want: Transient},
+		{name: "locked table", err: fmt.Errorf("query: %w", errors.New("database table is locked: BlockSearch")), want: Transient},
+		{name: "missing index", err: fmt.Errorf("open: %w", os.ErrNotExist), want: Transient},
+		{name: "unopenable file", err: errors.New("unable to open database file"), want: Transient},
+		{name: "syntax error", err: errors.New(`near "SELEC": syntax error`), want: Fatal},
+		{name: "corrupt index", err: errors.New("database disk image is malformed"), want: Fatal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewError("title", tt.err).Category; got != tt.want {
+				t.Errorf("category = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorConstructors(t *testing.T) {
+	cause := errors.New("database is locked")
+
+	if got := NewConfigError("title", cause).Category; got != Config {
+		t.Errorf("NewConfigError() category = %v, want Config", got)
+	}
+	if got := NewTransientError("title", errors.New("no index files found")).Category; got != Transient {
+		t.Errorf("NewTransientError() category = %v, want Transient", got)
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	err := fmt.Errorf("get config: %w", NewConfigError("Invalid workflow configuration", os.ErrNotExist))
+
+	var te Error
+	if !errors.As(err, &te) || te.Category != Config {
+		t.Fatalf("errors.As() = %+v, want the config error", te)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("the cause is not reachable through the error")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+)
+
+// variableNames are the workflow variables the workflow reads.
+var variableNames = []string{"allSpaces", "primarySpace", "daily", "currentDocumentId", "mode", "createContent", "searchMode", "profile"}
+
+// readVariables returns the workflow variables. Alfred passes them in the
+// environment. A JSON object on stdin with a "variables" map, such as
+// {"variables": {"allSpaces": "1"}}, is specific to this run and so takes
+// precedence over the environment, variable by variable. Malformed stdin is
+// ignored.
+func readVariables(stdin io.Reader) map[string]string {
+	vars := make(map[string]string, len(variableNames))
+	for _, name := range variableNames {
+		if value := os.Getenv(name); value != "" {
+			vars[name] = value
+		}
+	}
+
+	if stdin == nil {
+		return vars
+	}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil || len(data) == 0 {
+		return vars
+	}
+
+	var input struct {
+		Variables map[string]string `json:"variables"`
+	}
+	if err := json.Unmarshal(data, &input); err != nil {
+		log.Printf("Ignoring malformed variables on stdin: %v", err)
+		return vars
+	}
+
+	for _, name := range variableNames {
+		if value := input.Variables[name]; value != "" {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// pipedStdin returns stdin when something is piped into it. Reading a
+// terminal would block until the user closes it.
+func pipedStdin() io.Reader {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return nil
+	}
+	return os.Stdin
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadVariables(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		stdin string
+		want  map[string]string
+	}{
+		{
+			name: "environment only",
+			env:  map[string]string{"allSpaces": "1", "mode": "create"},
+			want: map[string]string{"allSpaces": "1", "mode": "create"},
+		},
+		{
+			name:  "stdin only",
+			stdin: `{"variables": {"allSpaces": "1", "primarySpace": "s2", "unknown": "x"}}`,
+			want:  map[string]string{"allSpaces": "1", "primarySpace": "s2"},
+		},
+		{
+			name:  "stdin takes precedence",
+			env:   map[string]string{"allSpaces": "0", "daily": "1"},
+			stdin: `{"variables": {"allSpaces": "1", "daily": ""}}`,
+			want:  map[string]string{"allSpaces": "1", "daily": "1"},
+		},
+		{
+			name:  "malformed stdin",
+			env:   map[string]string{"allSpaces": "1"},
+			stdin: `{"variables": {"allSpaces": `,
+			want:  map[string]string{"allSpaces": "1"},
+		},
+		{
+			name:  "stdin without variables",
+			env:   map[string]string{"allSpaces": "1"},
+			stdin: `["allSpaces"]`,
+			want:  map[string]string{"allSpaces": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range variableNames {
+				setEnv(t, name, tt.env[name])
+			}
+
+			var got map[string]string
+			if tt.stdin == "" {
+				got = readVariables(nil)
+			} else {
+				got = readVariables(strings.NewReader(tt.stdin))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
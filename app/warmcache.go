@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/cache"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+// documentTitlesCacheKey is the workflow cache entry holding warmed titles.
+const documentTitlesCacheKey = "document_titles.json"
+
+// warmResultLimit is the number of top results whose document titles are
+// stored in the workflow cache when WARM_CACHE is enabled.
+const warmResultLimit = 10
+
+// warmedTitles holds the document titles of the top results of the last
+// query, valid as long as the search indexes are not modified after
+// IndexModTime.
+type warmedTitles struct {
+	IndexModTime time.Time         `json:"indexModTime"`
+	Titles       map[string]string `json:"titles"`
+}
+
+// warmDocumentTitles stores the parent document titles of the top results,
+// keyed by repository.DocumentKey, so that a follow-up query on one of them,
+// such as listing the blocks of its document, does not look them up again.
+// The results carry their titles already, the index is not queried.
+func warmDocumentTitles(store cache.Store, indexModTime time.Time, blocks []repository.Block) {
+	if len(blocks) > warmResultLimit {
+		blocks = blocks[:warmResultLimit]
+	}
+
+	titles := make(map[string]string, len(blocks))
+	for _, block := range blocks {
+		if block.DocumentTitle != "" {
+			titles[repository.DocumentKey(block.SpaceID, block.DocumentID)] = block.DocumentTitle
+		}
+	}
+
+	_ = store.StoreJSON(documentTitlesCacheKey, warmedTitles{IndexModTime: indexModTime, Titles: titles})
+}
+
+// loadDocumentTitles returns the warmed document titles when the search
+// indexes have not changed since they were stored.
+func loadDocumentTitles(store cache.Store, indexModTime time.Time) (map[string]string, bool) {
+	var warmed warmedTitles
+	if err := store.LoadJSON(documentTitlesCacheKey, &warmed); err != nil {
+		return nil, false
+	}
+	if !warmed.IndexModTime.Equal(indexModTime) || len(warmed.Titles) == 0 {
+		return nil, false
+	}
+
+	return warmed.Titles, true
+}
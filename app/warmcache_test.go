@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/kudrykv/alfred-craftdocs-searchindex/app/repository"
+)
+
+func TestWarmDocumentTitles(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	blocks := []repository.Block{
+		{ID: "doc1", DocumentID: "doc1", SpaceID: "s1", EntityType: "document", Content: "Plan", DocumentTitle: "Plan"},
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1", Content: "step one", DocumentTitle: "Plan"},
+		{ID: "b2", DocumentID: "doc2", SpaceID: "s2", Content: "notes", DocumentTitle: "Meeting"},
+		{ID: "b3", SpaceID: "s1", Content: "orphan"},
+	}
+
+	warmDocumentTitles(store, modTime, blocks)
+
+	titles, ok := loadDocumentTitles(store, modTime)
+	if !ok {
+		t.Fatal("loadDocumentTitles() found nothing after warming")
+	}
+
+	want := map[string]string{
+		repository.DocumentKey("s1", "doc1"): "Plan",
+		repository.DocumentKey("s2", "doc2"): "Meeting",
+	}
+	if len(titles) != len(want) {
+		t.Fatalf("titles = %v, want %v", titles, want)
+	}
+	for key, title := range want {
+		if titles[key] != title {
+			t.Errorf("titles[%q] = %q, want %q", key, titles[key], title)
+		}
+	}
+}
+
+func TestWarmDocumentTitlesTopResultsOnly(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Now()
+
+	var blocks []repository.Block
+	for i := 0; i < warmResultLimit+5; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		blocks = append(blocks, repository.Block{ID: "b" + id, DocumentID: id, SpaceID: "s1", DocumentTitle: "Title " + id})
+	}
+
+	warmDocumentTitles(store, modTime, blocks)
+
+	titles, _ := loadDocumentTitles(store, modTime)
+	if len(titles) != warmResultLimit {
+		t.Errorf("warmed %d titles, want %d", len(titles), warmResultLimit)
+	}
+	if _, ok := titles[repository.DocumentKey("s1", fmt.Sprintf("doc%d", warmResultLimit))]; ok {
+		t.Error("warmed the title of a result beyond the limit")
+	}
+}
+
+func TestLoadDocumentTitlesStaleIndex(t *testing.T) {
+	store := aw.NewCache(t.TempDir())
+	modTime := time.Now()
+
+	warmDocumentTitles(store, modTime, []repository.Block{
+		{ID: "b1", DocumentID: "doc1", SpaceID: "s1", DocumentTitle: "Plan"},
+	})
+
+	if _, ok := loadDocumentTitles(store, modTime.Add(time.Second)); ok {
+		t.Error("loadDocumentTitles() used titles warmed before the index changed")
+	}
+}
+
+func TestLoadDocumentTitlesEmptyCache(t *testing.T) {
+	if _, ok := loadDocumentTitles(aw.NewCache(t.TempDir()), time.Now()); ok {
+		t.Error("loadDocumentTitles() found titles in an empty cache")
+	}
+}
@@ -6,4 +6,5 @@ require (
 	github.com/caarlos0/env/v6 v6.6.2
 	github.com/deanishe/awgo v0.28.0
 	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/text v0.3.5
 )
@@ -17,7 +17,7 @@ echo "Prep to build for OSes ${_gooses[*]} with arches ${_goarches[*]}"
 for _goos in "${_gooses[@]}"; do
   for _goarch in "${_goarches[@]}"; do
     echo -n "Building for OS ${_goos} arch ${_goarch}... "
-    GOOS=${_goos} GOARCH=${_goarch} CGO_ENABLED=1 go build --tags fts5 -o run ./app
+    GOOS=${_goos} GOARCH=${_goarch} CGO_ENABLED=1 go build --tags fts5 -ldflags "-X main.version=${_version}" -o run ./app
     echo "built"
 
     _zipname="CraftDocs_SearchIndex_${_version}_${_goos}_${_goarch}.alfredworkflow"